@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/server"
+)
+
+// export writes the messages recorded by the server, without running it. The
+// history file is the one of the server configuration unless given.
+//  	gochat-term export [-config file] [-history file] [-channel name] [-from time] [-to time] [-format text|json|html] [-o file]
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	config := flags.String("config", os.Getenv("GOCHAT_CONFIG"), "TOML configuration file of the server ($GOCHAT_CONFIG)")
+	path := flags.String("history", "", "history file of the server, storage.history of its configuration if empty")
+	channel := flags.String("channel", "", "channel to export, all of them if empty")
+	fromFlag := flags.String("from", "", "export messages emitted from this time")
+	toFlag := flags.String("to", "", "export messages emitted until this time")
+	format := flags.String("format", history.Text, "text, json or html")
+	out := flags.String("o", "", "output file, standard output if empty")
+	flags.Parse(args)
+
+	if *path == "" {
+		c, err := server.LoadConfig(*config)
+		if err != nil {
+			return err
+		}
+		if c.HistoryPath == "" {
+			return errors.New("the server keeps its history in memory only")
+		}
+		*path = c.HistoryPath
+	}
+
+	var from, to time.Time
+	var err error
+	if *fromFlag != "" {
+		if from, err = history.ParseTime(*fromFlag); err != nil {
+			return err
+		}
+	}
+	if *toFlag != "" {
+		if to, err = history.ParseTime(*toFlag); err != nil {
+			return err
+		}
+	}
+
+	records, err := history.Load(*path)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+
+	title := *channel
+	if title == "" {
+		title = *path
+	}
+	return history.Export(w, title, history.Filter(records, *channel, from, to), *format)
+}
+
+func exportMain(args []string) {
+	if err := export(args); err != nil {
+		fmt.Fprintln(os.Stderr, "export :", err)
+		os.Exit(1)
+	}
+}
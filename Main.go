@@ -1,8 +1,35 @@
 package main
 
-import "github.com/Spriithy/gochat-term/server"
+import (
+	"fmt"
+	"os"
+
+	"github.com/Spriithy/gochat-term/server"
+
+	// plugins built into the server
+	_ "github.com/Spriithy/gochat-term/server/plugin/dice"
+)
 
 func main() {
-	serv := server.NewServer("ChatRoom", 8081)
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		exportMain(os.Args[2:])
+		return
+	}
+
+	c, _, err := server.ParseConfig(os.Args[0], os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	serv, err := server.NewServerConfig(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	serv.SetReloader(func() (*server.Config, error) {
+		c, _, err := server.ParseConfig(os.Args[0], os.Args[1:])
+		return c, err
+	})
 	serv.Start()
 }
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// keyDir holds the client's private key and the public keys it trusts
+var keyDir = filepath.Join(os.Getenv("HOME"), ".gochat")
+
+// keys is the KeyPair used to open the whispers we receive
+var keys *network.KeyPair
+
+var contacts = struct {
+	sync.Mutex
+	// known are the trusted public keys, by username
+	known map[string]string
+	// changed are keys that differ from the trusted ones, until /trust
+	changed map[string]string
+	// pending are whispers waiting for their recipient's key
+	pending map[string][]string
+}{known: make(map[string]string), changed: make(map[string]string), pending: make(map[string][]string)}
+
+func warn(a ...interface{}) {
+	print("[" + colors.RED + "warning" + colors.NONE + "] ")
+	for _, x := range a {
+		print(x, " ")
+	}
+	println()
+}
+
+// loadKeys loads the client's KeyPair, generating it on first use, and the
+// public keys it trusts
+func loadKeys() error {
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(keyDir, "key")
+	raw, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		keys, err = network.LoadKeyPair(raw)
+	case os.IsNotExist(err):
+		if keys, err = network.GenerateKeyPair(); err == nil {
+			err = ioutil.WriteFile(path, keys.Bytes(), 0600)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(keyDir, "known_keys"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contacts.Lock()
+	defer contacts.Unlock()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			contacts.known[fields[0]] = fields[1]
+		}
+	}
+	return scanner.Err()
+}
+
+// saveKnown writes the trusted public keys, contacts must be locked
+func saveKnown() error {
+	var buf strings.Builder
+	for name, key := range contacts.known {
+		buf.WriteString(name + " " + key + "\n")
+	}
+	return ioutil.WriteFile(filepath.Join(keyDir, "known_keys"), []byte(buf.String()), 0600)
+}
+
+// check compares a user's key with the trusted one, trusting it on first use.
+// It returns false if the key changed, contacts must be locked
+func check(name, key string) bool {
+	known, ok := contacts.known[name]
+	if !ok {
+		contacts.known[name] = key
+		if err := saveKnown(); err != nil {
+			warn("couldn't save known keys :", err.Error())
+		}
+		println("Trusting", colors.GREEN+name+colors.NONE, "key", network.Fingerprint(key))
+		return true
+	}
+
+	if known == key {
+		delete(contacts.changed, name)
+		return true
+	}
+
+	if contacts.changed[name] != key {
+		contacts.changed[name] = key
+		warn("the key of", name, "has changed!")
+		warn("  was", network.Fingerprint(known))
+		warn("  now", network.Fingerprint(key))
+		warn("verify it with", name, "then /trust", name)
+	}
+	return false
+}
+
+// whisper seals a message to a user, looking up their key first if needed
+func whisper(to, message string) {
+	contacts.Lock()
+	key, ok := contacts.known[to]
+	_, changed := contacts.changed[to]
+	if !ok {
+		contacts.pending[to] = append(contacts.pending[to], message)
+	}
+	contacts.Unlock()
+
+	if changed {
+		warn("not sending to", to, "until its new key is trusted")
+		return
+	}
+
+	if !ok {
+		send(network.KeyHead, ID+" lookup "+to)
+		return
+	}
+
+	sealed, err := keys.Seal(key, message)
+	if err != nil {
+		warn("couldn't seal message to", to, ":", err.Error())
+		return
+	}
+	send(network.WhisperHead, ID+" "+to+" "+sealed)
+}
+
+// onKey handles the answer to a key lookup
+// Content : NAME KEY
+func onKey(content string) {
+	fields := strings.SplitN(content, " ", 2)
+	if len(fields) != 2 || network.CheckPublicKey(fields[1]) != nil {
+		return
+	}
+
+	contacts.Lock()
+	trusted := check(fields[0], fields[1])
+	pending := contacts.pending[fields[0]]
+	if trusted {
+		delete(contacts.pending, fields[0])
+	}
+	contacts.Unlock()
+
+	if trusted {
+		for _, message := range pending {
+			whisper(fields[0], message)
+		}
+	}
+}
+
+// onWhisper displays a whisper relayed by the server
+// Content : FROM MESSAGE
+func onWhisper(content string) {
+	fields := strings.SplitN(content, " ", 2)
+	if len(fields) != 2 {
+		return
+	}
+
+	from, message := fields[0], fields[1]
+	if !network.IsSealed(message) {
+		display(history.Record{Head: string(network.WhisperHead), Channel: "@" + from, Name: from, Content: "(unencrypted) " + message})
+		return
+	}
+
+	key, message, err := keys.Open(message)
+	if err != nil {
+		warn("couldn't open whisper from", from, ":", err.Error())
+		return
+	}
+
+	contacts.Lock()
+	trusted := check(from, key)
+	contacts.Unlock()
+
+	// a changed key may not be the sender's until it is trusted
+	if !trusted {
+		message = "(unverified key, /trust " + from + " once checked) " + message
+	}
+	display(history.Record{Head: string(network.WhisperHead), Channel: "@" + from, Name: from, Content: message})
+}
+
+// trustKey accepts the new key of a user
+func trustKey(name string) {
+	contacts.Lock()
+	key, ok := contacts.changed[name]
+	if ok {
+		delete(contacts.changed, name)
+		contacts.known[name] = key
+		if err := saveKnown(); err != nil {
+			warn("couldn't save known keys :", err.Error())
+		}
+	}
+	contacts.Unlock()
+
+	if !ok {
+		println("The key of", name, "hasn't changed")
+		return
+	}
+	println("Trusting", colors.GREEN+name+colors.NONE, "key", network.Fingerprint(key))
+	send(network.KeyHead, ID+" lookup "+name)
+}
+
+// showFingerprint prints the fingerprint of our key, or of a user's one
+func showFingerprint(name string) {
+	if name == "" {
+		println("Your key", network.Fingerprint(keys.PublicKey()))
+		return
+	}
+
+	contacts.Lock()
+	key, ok := contacts.known[name]
+	contacts.Unlock()
+
+	if !ok {
+		println("No known key for", name)
+		return
+	}
+	println(colors.GREEN+name+colors.NONE, "key", network.Fingerprint(key))
+}
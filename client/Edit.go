@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// refSize is the amount of trailing digits of a message id shown to refer to
+// the message, ie. #3f2a
+const refSize = 4
+
+// ref returns the short reference of a message id
+func ref(id string) string {
+	if len(id) < refSize {
+		return ""
+	}
+	return " " + colors.LIGHT_CYAN + "#" + id[len(id)-refSize:] + colors.NONE
+}
+
+// resolve returns the id of the most recent message a reference designates.
+// An empty reference designates our last message.
+func resolve(reference string) (string, bool) {
+	records := received.Range("", time.Time{}, time.Time{})
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.ID == "" {
+			continue
+		}
+		if reference == "" && r.Name == nickname || reference != "" && strings.HasSuffix(r.ID, reference) {
+			return r.ID, true
+		}
+	}
+	return "", false
+}
+
+// target reads the optional #REF argument of /edit and /delete
+func target(args []string) (string, []string, bool) {
+	reference := ""
+	if len(args) > 0 && strings.HasPrefix(args[0], "#") {
+		reference, args = args[0][1:], args[1:]
+	}
+
+	id, ok := resolve(reference)
+	if !ok {
+		warn("no message to change")
+	}
+	return id, args, ok
+}
+
+// editMessage edits one of our messages, or any message as an operator
+//  	/edit [#REF] TEXT
+func editMessage(text string) {
+	fields := strings.Fields(text)[1:]
+	id, rest, ok := target(fields)
+	if !ok {
+		return
+	}
+	if len(rest) == 0 {
+		println("usage: /edit [#ref] <message>")
+		return
+	}
+
+	// keep the spacing of the new text
+	message := strings.TrimSpace(text[len("/edit"):])
+	if len(rest) < len(fields) {
+		message = strings.TrimSpace(message[len(fields[0]):])
+	}
+	send(network.EditHead, ID+" "+id+" "+message)
+}
+
+// deleteMessage deletes one of our messages, or any message as an operator
+//  	/delete [#REF]
+func deleteMessage(args []string) {
+	id, rest, ok := target(args)
+	if !ok {
+		return
+	}
+	if len(rest) != 0 {
+		println("usage: /delete [#ref]")
+		return
+	}
+	send(network.DeleteHead, ID+" "+id)
+}
+
+// onEdit shows the new text of an edited message
+// Content : MSGID NAME MESSAGE
+func onEdit(content string) {
+	fields := strings.SplitN(content, " ", 3)
+	if len(fields) != 3 {
+		return
+	}
+
+	id, editor, message := fields[0], fields[1], fields[2]
+	author := editor
+	if r, ok := received.Get(id); ok {
+		author = r.Name
+	}
+	received.Edit(id, editor, message)
+
+	note := "(edited)"
+	if editor != author {
+		note = "(edited by " + editor + ")"
+	}
+	println("["+colors.LIGHT_RED+time.Now().Format("15:04:05")+colors.NONE+"]"+ref(id)+" <"+colors.LIGHT_BLUE+author+colors.NONE+">", message, colors.LIGHT_CYAN+note+colors.NONE)
+}
+
+// onDelete forgets a deleted message
+// Content : MSGID NAME
+func onDelete(content string) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return
+	}
+
+	received.Delete(fields[0], fields[1])
+	println("["+colors.LIGHT_RED+time.Now().Format("15:04:05")+colors.NONE+"]"+ref(fields[0]), colors.LIGHT_CYAN+"message deleted by "+fields[1]+colors.NONE)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// maxHistory is the amount of messages the client remembers for exports
+const maxHistory = 5000
+
+// received are the messages displayed by the client
+var received, _ = history.NewStore("", maxHistory)
+
+// display prints a message once the triggers let it through, and records it.
+// Channel messages have an id, shown as a short reference (see ref), replies
+// quote their parent and messages mentioning us are highlighted.
+func display(r history.Record) {
+	if _, seen := received.Get(r.ID); r.ID != "" && seen {
+		// already shown by a mention notification
+		return
+	}
+
+	stopTyping(r.Name)
+	show, highlight := fire(r.Head[0], r.Name, r.Content)
+	if !show {
+		return
+	}
+	highlight = highlight || r.Head[0] == network.MessageHead && network.Mentioned(r.Content, nickname)
+
+	// replayed messages keep their time
+	r.Time = time.Now()
+	if t, ok := history.IDTime(r.ID); ok {
+		r.Time = t
+	}
+	stamp := "[" + colors.LIGHT_RED + r.Time.Format("15:04:05") + colors.NONE + "]"
+	if r.Parent != "" {
+		println(stamp, quote(r.Parent))
+	}
+
+	text := r.Content
+	if highlight {
+		text = highlighted(text)
+	}
+	println(stamp+ref(r.ID)+" <"+colors.LIGHT_BLUE+r.Name+colors.NONE+">", text)
+
+	received.Append(r)
+	if r.ID != "" {
+		markRead(r.ID)
+	}
+}
+
+// exportHistory writes the messages displayed by the client to a file
+//  	/export <text|json|html> <file> [from] [to]
+func exportHistory(args []string) {
+	if len(args) < 3 || len(args) > 5 {
+		println("usage: /export <text|json|html> <file> [from] [to]")
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if len(args) > 3 {
+		from, err = history.ParseTime(args[3])
+	}
+	if err == nil && len(args) > 4 {
+		to, err = history.ParseTime(args[4])
+	}
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", err.Error())
+		return
+	}
+
+	f, err := os.Create(args[2])
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", err.Error())
+		return
+	}
+	defer f.Close()
+
+	if err = history.Export(f, "gochat", received.Range("", from, to), args[1]); err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", err.Error())
+		return
+	}
+	println("Exported history to", args[2])
+}
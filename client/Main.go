@@ -2,14 +2,20 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"os/user"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/history"
 	"github.com/Spriithy/gochat-term/network"
 )
 
@@ -17,14 +23,28 @@ var (
 	clear = func() {
 		print("\033[H\033[2J")
 	}
+)
 
-	MSG_HEADER        = "\\M\\"
-	CONNECT_HEADER    = "\\C\\"
-	DISCONNECT_HEADER = "\\D\\"
+// address of the server, set with -server or $GOCHAT_SERVER, either
+// HOST:PORT or unix:PATH for a Unix domain socket
+var (
+	serverNetwork = "tcp"
+	serverAddr    = "127.0.0.1:8081"
 )
 
 var ID string
 
+// nickname is the name the user joined with
+var nickname string
+
+// key is the password of the channel, set with -key or $GOCHAT_KEY
+var key string
+
+// compress is set once the server accepted to exchange compressed packets
+var compress bool
+
+var frags = network.NewReassembler(network.FragmentTimeout)
+
 func regSplit(text string, delimeter string) []string {
 	reg := regexp.MustCompile(delimeter)
 	indexes := reg.FindAllStringIndex(text, -1)
@@ -38,45 +58,123 @@ func regSplit(text string, delimeter string) []string {
 	return result
 }
 
-func main() {
-	reader := bufio.NewReader(os.Stdin)
+// parseFlags reads the address of the server from the command line, or from
+// the environment
+func parseFlags() error {
+	addr := os.Getenv("GOCHAT_SERVER")
+	if addr == "" {
+		addr = serverAddr
+	}
+	flag.StringVar(&addr, "server", addr, "address of the server, HOST:PORT or unix:PATH ($GOCHAT_SERVER)")
+	flag.StringVar(&key, "key", os.Getenv("GOCHAT_KEY"), "password of the channel, if it has one ($GOCHAT_KEY)")
+	flag.Parse()
+
+	if strings.HasPrefix(addr, "unix:") {
+		serverNetwork, serverAddr = "unix", addr[len("unix:"):]
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errors.New("invalid server port " + port)
+	}
+	serverNetwork, serverAddr = "tcp", addr
+	return nil
+}
+
+// username asks the user for their name. Unix socket clients are known by
+// the server by their login name, which is used instead.
+func username(reader *bufio.Reader) string {
+	if serverNetwork == "unix" {
+		if u, err := user.Current(); err == nil {
+			return u.Username
+		}
+	}
+
 	fmt.Print("Enter username: ")
 	text, _ := reader.ReadString('\n')
-	name := regSplit(text[:len(text)-1], "[ \t\r\n]+")[0]
+	return regSplit(strings.TrimRight(text, "\r\n"), "[ \t\r\n]+")[0]
+}
+
+// listen opens the listener the server sends packets to. TCP clients listen
+// at the local address of their connection to the server, Unix socket ones
+// at a socket of their own which has to be announced.
+func listen(conn net.Conn) (net.Listener, string, error) {
+	if serverNetwork != "unix" {
+		l, err := net.Listen("tcp", conn.LocalAddr().String())
+		return l, "", err
+	}
+
+	path := filepath.Join(os.TempDir(), "gochat-"+strconv.Itoa(os.Getpid())+".sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the server may run as another user
+	if err := os.Chmod(path, 0666); err != nil {
+		l.Close()
+		return nil, "", err
+	}
+	return l, " " + network.ListenCapability + path, nil
+}
+
+func main() {
+	if err := parseFlags(); err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", err.Error())
+		os.Exit(1)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	nickname = username(reader)
 	clear()
 
-	conn, err := net.Dial("tcp", "127.0.0.1:8081")
+	if err := loadKeys(); err != nil {
+		panic(err)
+	}
+
+	if err := loadTriggers(); err != nil {
+		warn(err.Error())
+	}
+
+	conn, err := net.Dial(serverNetwork, serverAddr)
 	if err != nil {
 		panic(err)
 	}
 
-	l, err := net.Listen("tcp", conn.LocalAddr().String())
+	l, capabilities, err := listen(conn)
 	if err != nil {
 		panic(err)
 	}
 	defer l.Close()
-	conn.Write([]byte(CONNECT_HEADER + name))
+	if key != "" {
+		capabilities += " " + network.KeyCapability + key
+	}
+	join, err := network.UserPacket(network.JoinHead, "", nickname+" "+network.Deflate+capabilities)
+	if err != nil {
+		panic(err)
+	}
+	conn.Write([]byte(join.String()))
 	data := make([]byte, 1024)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
-		conn, err := net.Dial("tcp", "127.0.0.1:8081")
-		if err != nil {
-			panic(err)
-		}
-		for {
-			for range c {
-				_, err := conn.Write([]byte(DISCONNECT_HEADER + ID + "/leave"))
-				if err != nil {
-					panic(err)
-				}
-				println()
-				os.Exit(1)
-			}
+		for range c {
+			flushRead()
+			send(network.LeaveHead, ID)
+			l.Close()
+			println()
+			os.Exit(1)
 		}
 	}()
 
+	go prompt(reader)
+
 	for {
 		conn, err = l.Accept()
 		if err != nil {
@@ -84,32 +182,179 @@ func main() {
 		}
 
 		data = make([]byte, network.MaxPacketSize)
-		conn.Read(data)
+		n, _ := conn.Read(data)
+		data = data[:n]
+
+		if network.IsFragment(data) {
+			if data, err = frags.Add(network.Sender(conn.RemoteAddr()), data); err != nil || data == nil {
+				continue
+			}
+		}
+
 		go process(conn, data)
 	}
 }
 
+// prompt reads the user's input, running commands and sending anything else
+// as a channel message
+func prompt(reader *bufio.Reader) {
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		text = strings.TrimRight(text, "\r\n")
+		if len(text) == 0 {
+			continue
+		}
+
+		if text[0] != '/' {
+			send(network.MessageHead, ID+" "+text)
+			continue
+		}
+
+		args := regSplit(text[1:], "[ \t]+")
+		switch args[0] {
+		case "w", "whisper":
+			parts := strings.SplitN(text, " ", 3)
+			if len(parts) != 3 {
+				println("usage: /w <user> <message>")
+				continue
+			}
+			whisper(parts[1], parts[2])
+		case "export":
+			exportHistory(args)
+		case "reply":
+			replyMessage(text)
+		case "thread":
+			showThread(args[1:])
+		case "react":
+			reactMessage(args[1:])
+		case "edit":
+			editMessage(text)
+		case "delete":
+			deleteMessage(args[1:])
+		case "away":
+			setStatus(network.Away, args[1:])
+		case "dnd":
+			setStatus(network.DoNotDisturb, args[1:])
+		case "back":
+			setStatus(network.Online, nil)
+		case "members":
+			showMembers()
+		case "triggers":
+			if err := loadTriggers(); err != nil {
+				warn(err.Error())
+			}
+		case "trust":
+			if len(args) != 2 {
+				println("usage: /trust <user>")
+				continue
+			}
+			trustKey(args[1])
+		case "fingerprint":
+			if len(args) > 1 {
+				showFingerprint(args[1])
+			} else {
+				showFingerprint("")
+			}
+		case "send":
+			if len(args) != 3 {
+				println("usage: /send <user> <file>")
+				continue
+			}
+			offerFile(args[1], args[2])
+		case "accept", "decline":
+			if len(args) != 2 {
+				println("usage: /" + args[0] + " <file id>")
+				continue
+			}
+			answerOffer(args[1], args[0] == "accept")
+		default:
+			// commands of the server and its plugins
+			send(network.CommandHead, ID+" "+text[1:])
+		}
+	}
+}
+
 func process(conn net.Conn, data []byte) {
-	content := string(data)
-	println("RECEIVED: " + content)
-	switch {
-	case strings.HasPrefix(content, CONNECT_HEADER):
-		ID = content[len(CONNECT_HEADER):]
-		println("My ID is :", ID)
+	p, err := network.Parse(data)
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "dropped packet :", err.Error())
+		return
+	}
+
+	switch p.Header() {
+	case network.JoinHead:
+		// Content : ID [CAPABILITIES...], anyone may send it again
+		answered.Do(func() {
+			fields := strings.Split(p.Content(), " ")
+			ID = fields[0]
+			for _, capability := range fields[1:] {
+				compress = compress || capability == network.Deflate
+			}
+			close(joined)
+			send(network.KeyHead, ID+" publish "+keys.PublicKey())
+		})
+	case network.MessageHead:
+		// Content : MSGID NAME MESSAGE
+		fields := strings.SplitN(p.Content(), " ", 3)
+		if len(fields) == 3 {
+			display(history.Record{ID: fields[0], Head: string(network.MessageHead), Name: fields[1], Content: fields[2]})
+		}
+	case network.ReplyHead:
+		// Content : MSGID NAME PARENT MESSAGE
+		fields := strings.SplitN(p.Content(), " ", 4)
+		if len(fields) == 4 {
+			display(history.Record{ID: fields[0], Head: string(network.MessageHead), Name: fields[1], Parent: fields[2], Content: fields[3]})
+		}
+	case network.ReactionHead:
+		onReaction(p.Content())
+	case network.MentionHead:
+		// Content : MSGID FROM CHANNEL MESSAGE
+		fields := strings.SplitN(p.Content(), " ", 4)
+		if len(fields) == 4 {
+			print("\a")
+			display(history.Record{ID: fields[0], Head: string(network.MessageHead), Channel: fields[2], Name: fields[1], Content: fields[3]})
+		}
+	case network.TopicHead:
+		onTopic(p.Content())
+	case network.EditHead:
+		onEdit(p.Content())
+	case network.DeleteHead:
+		onDelete(p.Content())
+	case network.WhisperHead:
+		onWhisper(p.Content())
+	case network.KeyHead:
+		onKey(p.Content())
+	case network.OfferHead:
+		onOffer(p.Content())
+	case network.AcceptHead:
+		onAnswer(p.Content())
+	case network.ChunkHead:
+		onChunk(p.Content())
+	case network.PresenceHead:
+		onPresence(p.Content())
+	case network.TypingHead:
+		onTyping(p.Content())
+	case network.ReadHead:
+		onRead(p.Content())
+	default:
+		println(p.Content())
 	}
 }
 
-func send(addr, data string) {
-	conn, err := net.Dial("tcp", addr)
+func send(kind byte, content string) {
+	p, err := network.UserPacket(kind, "", content)
 	if err != nil {
-		println("["+colors.RED+"error"+colors.NONE+"]", "Couldn't reach server at", colors.GREEN+addr+colors.NONE)
-		println(strings.Repeat(" ", 7-1), colors.RED, err.Error(), colors.NONE)
+		println("["+colors.RED+"error"+colors.NONE+"]", colors.RED+err.Error(), colors.NONE)
 		return
 	}
-	_, err = conn.Write([]byte("\\C\\" + network.GetTimeStamp().String() + data))
 
+	err = network.SendTo(p, serverNetwork, serverAddr, compress)
 	if err != nil {
-		println("["+colors.RED+"error"+colors.NONE+"]", colors.RED+"couldn't send data to server :")
-		println(strings.Repeat(" ", 7), err.Error(), colors.NONE)
+		println("["+colors.RED+"error"+colors.NONE+"]", "Couldn't reach server at", colors.GREEN+serverAddr+colors.NONE)
+		println(strings.Repeat(" ", 7-1), colors.RED, err.Error(), colors.NONE)
 	}
 }
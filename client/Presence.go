@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// members are the status of the other users, by name
+var members = struct {
+	sync.Mutex
+	status map[string]string
+	note   map[string]string
+
+	// joined is set once our own arrival was announced, the statuses received
+	// before are the member list and aren't displayed
+	joined bool
+}{status: make(map[string]string), note: make(map[string]string)}
+
+// setStatus sends our status to the server
+//  	/away [note], /dnd [note], /back
+func setStatus(status string, args []string) {
+	content := ID + " " + status
+	if note := strings.Join(args, " "); note != "" {
+		content += " " + note
+	}
+	send(network.PresenceHead, content)
+	setAway(status != network.Online)
+}
+
+// onPresence records the status of a user
+// Content : NAME STATUS [NOTE]
+func onPresence(content string) {
+	fields := strings.SplitN(content, " ", 3)
+	if len(fields) < 2 {
+		return
+	}
+
+	name, status, note := fields[0], fields[1], ""
+	if len(fields) == 3 {
+		note = fields[2]
+	}
+
+	members.Lock()
+	if status == network.Offline {
+		delete(members.status, name)
+		delete(members.note, name)
+	} else {
+		members.status[name] = status
+		members.note[name] = note
+	}
+
+	show := members.joined
+	if name == nickname && status == network.Online {
+		members.joined = true
+	}
+	members.Unlock()
+
+	if show {
+		if note != "" {
+			note = " : " + note
+		}
+		println(colors.LIGHT_CYAN+"*", name, "is", status+note, colors.NONE)
+	}
+}
+
+// showMembers prints the users and their status
+func showMembers() {
+	members.Lock()
+	defer members.Unlock()
+
+	names := make([]string, 0, len(members.status))
+	for name := range members.status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	println(len(names), "users :")
+	for _, name := range names {
+		line := "  " + name + " (" + members.status[name] + ")"
+		if note := members.note[name]; note != "" {
+			line += " " + note
+		}
+		println(line)
+	}
+}
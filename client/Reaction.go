@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// reactMessage toggles our reaction to a channel message, the last one unless
+// a reference is given
+//  	/react [#REF] REACTION
+func reactMessage(args []string) {
+	if len(args) == 0 || len(args) > 2 || len(args) == 2 && !strings.HasPrefix(args[0], "#") {
+		println("usage: /react [#ref] <:reaction:>")
+		return
+	}
+
+	reaction := args[len(args)-1]
+	if !network.IsReaction(reaction) {
+		warn("invalid reaction", reaction, ", use :shortcode: or an emoji")
+		return
+	}
+
+	var id string
+	if len(args) == 2 {
+		var ok bool
+		if id, ok = resolve(args[0][1:]); !ok {
+			warn("no message", args[0])
+			return
+		}
+	} else {
+		records := received.Range("", time.Time{}, time.Time{})
+		for i := len(records) - 1; i >= 0 && id == ""; i-- {
+			id = records[i].ID
+		}
+		if id == "" {
+			warn("no message to react to")
+			return
+		}
+	}
+	send(network.ReactionHead, ID+" "+id+" "+reaction)
+}
+
+// onReaction shows the reactions to a message once one of them changed
+// Content : MSGID REACTION [NAMES...]
+func onReaction(content string) {
+	fields := strings.Fields(content)
+	if len(fields) < 2 {
+		return
+	}
+
+	id := fields[0]
+	received.SetReaction(id, fields[1], fields[2:])
+
+	summary := "no reactions"
+	if r, ok := received.Get(id); ok && len(r.Reactions) > 0 {
+		var parts []string
+		for reaction, names := range r.Reactions {
+			parts = append(parts, reaction+" "+strings.Join(names, ", "))
+		}
+		sort.Strings(parts)
+		summary = strings.Join(parts, "  ")
+	}
+	println("["+colors.LIGHT_RED+time.Now().Format("15:04:05")+colors.NONE+"]"+ref(id), colors.LIGHT_CYAN+summary+colors.NONE)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// readDelay is how long the read marker waits for more messages before it is
+// sent, so bursts of messages move it once
+const readDelay = 2 * time.Second
+
+// joined is closed once the server answered our join packet
+var joined = make(chan struct{})
+
+// answered handles the first answer to our join packet only
+var answered sync.Once
+
+// read is the last message shown, and the timer sending it as our read marker
+var read = struct {
+	sync.Mutex
+	last  string
+	timer *time.Timer
+}{}
+
+// markRead moves our read marker to a message shown, after readDelay
+func markRead(id string) {
+	read.Lock()
+	defer read.Unlock()
+
+	if id <= read.last {
+		return
+	}
+	read.last = id
+	if read.timer == nil {
+		read.timer = time.AfterFunc(readDelay, flushRead)
+	}
+}
+
+// flushRead sends our read marker if it moved
+func flushRead() {
+	read.Lock()
+	if read.timer == nil {
+		read.Unlock()
+		return
+	}
+	read.timer.Stop()
+	read.timer = nil
+	id := read.last
+	read.Unlock()
+
+	send(network.ReadHead, ID+" "+id)
+}
+
+// onRead shows a divider before the messages sent since our last visit, and
+// asks for them. The read receipts of others are listed by /seen.
+// Content : NAME MSGID UNREAD
+func onRead(content string) {
+	fields := strings.Fields(content)
+	if len(fields) != 3 || fields[0] != nickname {
+		return
+	}
+
+	since := ""
+	if t, ok := history.IDTime(fields[1]); ok {
+		since = " since " + t.Format("2006-01-02 15:04")
+	}
+	println(colors.LIGHT_CYAN + "──── " + fields[2] + " unread messages" + since + " ────" + colors.NONE)
+
+	// the answer to our join packet may still be on its way
+	<-joined
+	send(network.ReadHead, ID)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// quote returns the excerpt of a parent message shown above its replies
+func quote(parent string) string {
+	r, ok := received.Get(parent)
+	if !ok {
+		return colors.LIGHT_CYAN + "> (older message)" + colors.NONE
+	}
+	return colors.LIGHT_CYAN + "> " + r.Name + ": " + history.Excerpt(r.Content) + colors.NONE
+}
+
+// replyMessage replies to a channel message
+//  	/reply #REF TEXT
+func replyMessage(text string) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "#") {
+		println("usage: /reply #ref <message>")
+		return
+	}
+
+	id, ok := resolve(fields[1][1:])
+	if !ok {
+		warn("no message", fields[1])
+		return
+	}
+
+	// keep the spacing of the text
+	message := strings.TrimSpace(text[len("/reply"):])
+	message = strings.TrimSpace(message[len(fields[1]):])
+	send(network.ReplyHead, ID+" "+id+" "+message)
+}
+
+// showThread prints the thread a message belongs to, replies being indented
+// under their parent
+//  	/thread #REF
+func showThread(args []string) {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "#") {
+		println("usage: /thread #ref")
+		return
+	}
+
+	id, ok := resolve(args[0][1:])
+	if !ok {
+		warn("no message", args[0])
+		return
+	}
+
+	thread, depths := history.Thread(received.Range("", time.Time{}, time.Time{}), id)
+	println(colors.LIGHT_CYAN + "thread of" + ref(thread[0].ID) + colors.LIGHT_CYAN + " :" + colors.NONE)
+	for i, r := range thread {
+		println(strings.Repeat("  ", depths[i]+1)+"["+colors.LIGHT_RED+r.Time.Format("15:04:05")+colors.NONE+"]"+ref(r.ID)+" <"+colors.LIGHT_BLUE+r.Name+colors.NONE+">", r.Content)
+	}
+}
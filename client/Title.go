@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+)
+
+// title is the terminal title : the channel and its topic, followed by a
+// status such as the users typing
+var title = struct {
+	sync.Mutex
+	channel string
+	topic   string
+	status  string
+}{channel: "gochat"}
+
+// setTitle sets the status of the terminal title, and shows it
+func setTitle(status string) {
+	title.Lock()
+	title.status = status
+	text := "[ " + title.channel + " ]"
+	if title.topic != "" {
+		text += " " + title.topic
+	}
+	if title.status != "" {
+		text += " - " + title.status
+	}
+	title.Unlock()
+
+	print("\033]0;" + text + "\007")
+}
+
+// onTopic shows the topic of a channel, and puts it in the title
+// Content : CHANNEL SETTER UNIXTIME [TOPIC]
+func onTopic(content string) {
+	fields := strings.SplitN(content, " ", 4)
+	if len(fields) < 3 {
+		return
+	}
+
+	topic := ""
+	if len(fields) == 4 {
+		topic = fields[3]
+	}
+
+	title.Lock()
+	title.channel, title.topic = fields[0], topic
+	title.Unlock()
+	showTyping()
+
+	when := ""
+	if unix, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+		when = " on " + time.Unix(unix, 0).Format("2006-01-02 15:04")
+	}
+	if topic == "" {
+		println(colors.LIGHT_CYAN+"topic of "+fields[0]+" cleared by "+fields[1]+when+colors.NONE)
+		return
+	}
+	println(colors.LIGHT_CYAN+"topic of "+fields[0]+" : "+colors.NONE+topic, colors.LIGHT_CYAN+"(set by "+fields[1]+when+")"+colors.NONE)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// chunkSize is the amount of file data carried by a single chunk, small
+// enough for chunks not to be fragmented
+const chunkSize = 512
+
+// outgoing is a file offered to another user
+type outgoing struct {
+	id   string
+	to   string
+	path string
+	size int64
+}
+
+// incoming is a file offered by another user
+type incoming struct {
+	id       string
+	from     string
+	name     string
+	size     int64
+	sum      string
+	file     *os.File
+	received int64
+	progress int64
+}
+
+var transfers = struct {
+	sync.Mutex
+	out map[string]*outgoing
+	in  map[string]*incoming
+}{out: make(map[string]*outgoing), in: make(map[string]*incoming)}
+
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// report prints the progress of a transfer every 10%, returning the last
+// reported step
+func report(name string, done, total, last int64) int64 {
+	step := int64(10)
+	if total > 0 {
+		step = done * 10 / total
+	}
+
+	if step > last {
+		println("[" + colors.GREEN + name + colors.NONE + "] " + strconv.FormatInt(step*10, 10) + "%")
+	}
+	return step
+}
+
+// offerFile offers a file to another user, sent once they accept it
+func offerFile(to, path string) {
+	info, err := os.Stat(path)
+	if err == nil && !info.Mode().IsRegular() {
+		err = os.ErrInvalid
+	}
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "Can't send", path, ":", err.Error())
+		return
+	}
+
+	sum, err := checksum(path)
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "Can't send", path, ":", err.Error())
+		return
+	}
+
+	o := &outgoing{string(uuid.NextUUID()), to, path, info.Size()}
+	transfers.Lock()
+	transfers.out[o.id] = o
+	transfers.Unlock()
+
+	name := strings.Replace(filepath.Base(path), " ", "_", -1)
+	send(network.OfferHead, ID+" "+to+" "+o.id+" "+strconv.FormatInt(o.size, 10)+" "+sum+" "+name)
+	println("Offered", name, "to", to+", waiting for an answer")
+}
+
+// onOffer handles a file offer relayed by the server
+// Content : FROM FILEID SIZE SHA256 NAME
+func onOffer(content string) {
+	fields := strings.SplitN(content, " ", 5)
+	if len(fields) != 5 {
+		return
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return
+	}
+
+	in := &incoming{id: fields[1], from: fields[0], name: filepath.Base(fields[4]), size: size, sum: fields[3]}
+	transfers.Lock()
+	transfers.in[in.id] = in
+	transfers.Unlock()
+
+	println(colors.GREEN+in.from+colors.NONE, "wants to send you", in.name, "("+fields[2]+" bytes)")
+	println("  /accept", in.id, "or /decline", in.id)
+}
+
+// answerOffer accepts or declines a pending file offer
+func answerOffer(id string, accept bool) {
+	transfers.Lock()
+	in, ok := transfers.in[id]
+	if ok && !accept {
+		delete(transfers.in, id)
+	}
+	transfers.Unlock()
+
+	if !ok || in.file != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "No pending file", id)
+		return
+	}
+
+	if accept {
+		f, err := os.OpenFile(in.name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			println("["+colors.RED+"error"+colors.NONE+"]", "Can't receive", in.name, ":", err.Error())
+			answerOffer(id, false)
+			return
+		}
+
+		transfers.Lock()
+		in.file = f
+		if in.size == 0 {
+			delete(transfers.in, id)
+		}
+		transfers.Unlock()
+
+		send(network.AcceptHead, ID+" "+id+" yes")
+		if in.size == 0 {
+			finish(in)
+		}
+		return
+	}
+
+	send(network.AcceptHead, ID+" "+id+" no")
+}
+
+// onAnswer handles the answer to one of our offers
+// Content : NAME FILEID yes|no
+func onAnswer(content string) {
+	fields := strings.SplitN(content, " ", 3)
+	if len(fields) != 3 {
+		return
+	}
+
+	transfers.Lock()
+	o, ok := transfers.out[fields[1]]
+	delete(transfers.out, fields[1])
+	transfers.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if fields[2] != "yes" {
+		println(colors.GREEN+fields[0]+colors.NONE, "declined", filepath.Base(o.path))
+		return
+	}
+
+	go upload(o)
+}
+
+func upload(o *outgoing) {
+	f, err := os.Open(o.path)
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "Can't send", o.path, ":", err.Error())
+		return
+	}
+	defer f.Close()
+
+	name := filepath.Base(o.path)
+	buf := make([]byte, chunkSize)
+	var offset, last int64
+	for offset < o.size {
+		n, err := f.Read(buf)
+		if n > 0 {
+			send(network.ChunkHead, ID+" "+o.id+" "+strconv.FormatInt(offset, 10)+" "+string(buf[:n]))
+			offset += int64(n)
+			last = report(name, offset, o.size, last)
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				println("["+colors.RED+"error"+colors.NONE+"]", "Can't send", o.path, ":", err.Error())
+			}
+			return
+		}
+	}
+}
+
+// onChunk writes a slice of an accepted file
+// Content : FILEID OFFSET DATA
+func onChunk(content string) {
+	fields := strings.SplitN(content, " ", 3)
+	if len(fields) != 3 {
+		return
+	}
+
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	transfers.Lock()
+	in, ok := transfers.in[fields[0]]
+	if !ok || in.file == nil {
+		transfers.Unlock()
+		return
+	}
+
+	_, err = in.file.WriteAt([]byte(fields[2]), offset)
+	in.received += int64(len(fields[2]))
+	in.progress = report(in.name, in.received, in.size, in.progress)
+	done := err != nil || in.received >= in.size
+	if done {
+		delete(transfers.in, in.id)
+	}
+	transfers.Unlock()
+
+	if err != nil {
+		println("["+colors.RED+"error"+colors.NONE+"]", "Can't write", in.name, ":", err.Error())
+	}
+
+	if done {
+		finish(in)
+	}
+}
+
+// finish closes a received file and verifies its checksum
+func finish(in *incoming) {
+	in.file.Close()
+
+	sum, err := checksum(in.name)
+	if err != nil || sum != in.sum {
+		os.Remove(in.name)
+		println("["+colors.RED+"error"+colors.NONE+"]", in.name, "from", in.from, "is corrupted, it has been deleted")
+		return
+	}
+
+	println("Received", colors.GREEN+in.name+colors.NONE, "from", in.from)
+}
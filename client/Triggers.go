@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Spriithy/go-colors"
+	"github.com/Spriithy/gochat-term/network"
+)
+
+// Triggers react to incoming messages before they are displayed. They are
+// read from ~/.gochat/triggers, one per line :
+//
+//  	ON PATTERN ACTION [ARGUMENT]
+//
+// - ON is message, whisper or any
+// - PATTERN is a regular expression matched against "NAME MESSAGE", it can't
+// contain spaces (use \s)
+// - ACTION is one of :
+//  	-> highlight    : color the message
+//  	-> bell         : ring the terminal bell
+//  	-> hide         : don't display the message
+//  	-> reply TEXT   : whisper TEXT back to the sender once, while /away
+//  	-> run COMMAND  : run COMMAND with sh, given $GOCHAT_NAME and $GOCHAT_MESSAGE
+//
+// Every matching trigger runs, in order. Lines starting with # are ignored.
+//
+
+// triggersPath is the file triggers are read from
+var triggersPath = filepath.Join(keyDir, "triggers")
+
+// trigger reacts to the incoming messages matching its pattern
+type trigger struct {
+	on      byte
+	pattern *regexp.Regexp
+	action  string
+	arg     string
+}
+
+var triggers = struct {
+	sync.Mutex
+	list []trigger
+
+	// away is set by /away, replied are the users auto-replied since
+	away    bool
+	replied map[string]bool
+}{replied: make(map[string]bool)}
+
+// parseTriggers reads a triggers file
+func parseTriggers(r io.Reader) ([]trigger, error) {
+	var list []trigger
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		fail := func(msg string) error {
+			return errors.New("line " + strconv.Itoa(line) + " : " + msg)
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fail("expected ON PATTERN ACTION [ARGUMENT]")
+		}
+
+		var t trigger
+		switch fields[0] {
+		case "message":
+			t.on = network.MessageHead
+		case "whisper":
+			t.on = network.WhisperHead
+		case "any":
+		default:
+			return nil, fail("unknown event " + fields[0])
+		}
+
+		var err error
+		if t.pattern, err = regexp.Compile(fields[1]); err != nil {
+			return nil, fail(err.Error())
+		}
+
+		t.action = fields[2]
+		t.arg = text
+		for _, field := range fields[:3] {
+			t.arg = strings.TrimSpace(t.arg[len(field):])
+		}
+		switch t.action {
+		case "highlight", "bell", "hide":
+		case "reply", "run":
+			if t.arg == "" {
+				return nil, fail(t.action + " requires an argument")
+			}
+		default:
+			return nil, fail("unknown action " + t.action)
+		}
+		list = append(list, t)
+	}
+	return list, scanner.Err()
+}
+
+// loadTriggers reads the triggers file, which may not exist
+func loadTriggers() error {
+	f, err := os.Open(triggersPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	list, err := parseTriggers(f)
+	if err != nil {
+		return errors.New(triggersPath + " : " + err.Error())
+	}
+
+	triggers.Lock()
+	triggers.list = list
+	triggers.Unlock()
+	return nil
+}
+
+// setAway toggles the auto-replies of the reply triggers
+func setAway(away bool) {
+	triggers.Lock()
+	triggers.away = away
+	triggers.replied = make(map[string]bool)
+	triggers.Unlock()
+}
+
+// fire runs the triggers matching an incoming message, and tells whether and
+// how to display it
+func fire(head byte, name, message string) (show, highlight bool) {
+	show = true
+	if name == nickname {
+		return
+	}
+
+	triggers.Lock()
+	defer triggers.Unlock()
+
+	subject := name + " " + message
+	for _, t := range triggers.list {
+		if (t.on != 0 && t.on != head) || !t.pattern.MatchString(subject) {
+			continue
+		}
+
+		switch t.action {
+		case "highlight":
+			highlight = true
+		case "bell":
+			print("\a")
+		case "hide":
+			show = false
+		case "reply":
+			if triggers.away && !triggers.replied[name] {
+				triggers.replied[name] = true
+				go whisper(name, t.arg)
+			}
+		case "run":
+			cmd := exec.Command("sh", "-c", t.arg)
+			cmd.Env = append(os.Environ(), "GOCHAT_NAME="+name, "GOCHAT_MESSAGE="+message)
+			if err := cmd.Start(); err != nil {
+				warn("trigger couldn't run", t.arg, ":", err.Error())
+				continue
+			}
+			go cmd.Wait()
+		}
+	}
+	return
+}
+
+// highlighted colors a highlighted message
+func highlighted(message string) string {
+	return colors.LIGHT_GREEN + message + colors.NONE
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The terminal delivers the input of the user a whole line at once, on Enter,
+// so the client can't tell when its user is typing. It only shows the others
+// typing, the browser client sends typing packets.
+
+// typingTimeout is how long a user is shown typing without news from them
+const typingTimeout = 6 * time.Second
+
+// typing are the users currently typing, with the time they stop being shown.
+// Whispering users are prefixed by @.
+var typing = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+// onTyping shows that a user is typing
+// Content : NAME [whisper]
+func onTyping(content string) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 || fields[0] == nickname {
+		return
+	}
+
+	label := fields[0]
+	if len(fields) == 2 {
+		label = "@" + label
+	}
+
+	typing.Lock()
+	typing.until[label] = time.Now().Add(typingTimeout)
+	typing.Unlock()
+
+	showTyping()
+	time.AfterFunc(typingTimeout, showTyping)
+}
+
+// stopTyping forgets a user once their message arrived
+func stopTyping(name string) {
+	typing.Lock()
+	delete(typing.until, name)
+	delete(typing.until, "@"+name)
+	typing.Unlock()
+	showTyping()
+}
+
+// showTyping shows the users typing in the terminal title, forgetting the
+// ones that expired (see Title.go)
+func showTyping() {
+	typing.Lock()
+	var names []string
+	for label, until := range typing.until {
+		if time.Now().After(until) {
+			delete(typing.until, label)
+			continue
+		}
+		names = append(names, label)
+	}
+	typing.Unlock()
+
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		setTitle("")
+	case 1:
+		setTitle(names[0] + " is typing...")
+	default:
+		setTitle(strings.Join(names, ", ") + " are typing...")
+	}
+}
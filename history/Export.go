@@ -0,0 +1,89 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+)
+
+// Export formats
+const (
+	Text = "text"
+	JSON = "json"
+	HTML = "html"
+)
+
+// Export writes records to w in the given format :
+//  	-> text : [HH:MM:SS] <name> message [(edited)] [reaction count...]
+//  	-> json : one JSON record per line
+//  	-> html : a standalone HTML page
+func Export(w io.Writer, title string, records []Record, format string) error {
+	switch format {
+	case Text:
+		for _, r := range records {
+			edited := ""
+			if r.Edited {
+				edited = " (edited)"
+			}
+			if _, err := fmt.Fprintf(w, "[%s] <%s> %s%s%s\n", r.Time.Format("15:04:05"), r.Name, r.Content, edited, reactions(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case HTML:
+		return page.Execute(w, struct {
+			Title   string
+			Records []Record
+		}{title, records})
+	default:
+		return errors.New("unknown export format " + format)
+	}
+}
+
+// reactions summarizes the reactions to r, ie. " [:+1: 2] [:tada: 1]"
+func reactions(r Record) string {
+	keys := make([]string, 0, len(r.Reactions))
+	for k := range r.Reactions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	summary := ""
+	for _, k := range keys {
+		summary += fmt.Sprintf(" [%s %d]", k, len(r.Reactions[k]))
+	}
+	return summary
+}
+
+var page = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { background: #1d1f21; color: #c5c8c6; font-family: monospace; margin: 2em; }
+h1 { color: #b294bb; font-size: 1.2em; }
+.time { color: #cc6666; }
+.name { color: #81a2be; font-weight: bold; }
+.edited { color: #969896; }
+.reaction { color: #f0c674; }
+p { margin: 0.2em 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>[ {{.Title}} ]</h1>
+{{range .Records}}<p><span class="time" title="{{.Time.Format "2006-01-02 15:04:05"}}">[{{.Time.Format "15:04:05"}}]</span> <span class="name">&lt;{{.Name}}&gt;</span> {{.Content}}{{if .Edited}} <span class="edited">(edited)</span>{{end}}{{range $reaction, $names := .Reactions}} <span class="reaction">[{{$reaction}} {{len $names}}]</span>{{end}}</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,44 @@
+package history
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var records = []Record{
+	{Time: time.Date(2016, 11, 18, 9, 5, 3, 0, time.Local), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "hello"},
+	{Time: time.Date(2016, 11, 18, 12, 30, 0, 0, time.Local), Channel: "ChatRoom", Head: "M", Name: "Springwater64", Content: "<b>hi</b>"},
+	{Time: time.Date(2016, 11, 19, 8, 0, 0, 0, time.Local), Channel: "Lobby", Head: "M", Name: "joncena", Content: "bye"},
+}
+
+func TestTextExport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, "ChatRoom", Filter(records, "ChatRoom", time.Time{}, time.Time{}), Text); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[09:05:03] <joncena> hello\n[12:30:00] <Springwater64> <b>hi</b>\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected text export :\n%s", buf.String())
+	}
+}
+
+func TestHTMLExportEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, "ChatRoom", records, HTML); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<b>hi</b>") {
+		t.Error("message content isn't escaped")
+	}
+}
+
+func TestFilterRange(t *testing.T) {
+	from := time.Date(2016, 11, 18, 10, 0, 0, 0, time.Local)
+	to := time.Date(2016, 11, 19, 0, 0, 0, 0, time.Local)
+	if out := Filter(records, "", from, to); len(out) != 1 || out[0].Name != "Springwater64" {
+		t.Errorf("unexpected records in range : %v", out)
+	}
+}
@@ -0,0 +1,551 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a message kept in a channel's history
+//
+type Record struct {
+	ID      string    `json:"id,omitempty"`
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	Head    string    `json:"head"`
+	Name    string    `json:"name"`
+	Content string    `json:"content"`
+	Edited  bool      `json:"edited,omitempty"`
+
+	// Parent is the ID of the record a reply answers
+	Parent string `json:"parent,omitempty"`
+
+	// Reactions are the users who reacted to the record, by reaction
+	Reactions map[string][]string `json:"reactions,omitempty"`
+}
+
+// Heads of the records changing the record identified by their ID. They are
+// appended to history files, and applied when loading them.
+// Reaction records hold the reaction followed by every user who reacted.
+const (
+	EditRecord     = "E"
+	DeleteRecord   = "D"
+	ReactionRecord = "U"
+)
+
+// excerptSize is the amount of characters of an excerpt
+const excerptSize = 40
+
+// Excerpt returns the beginning of the first line of a message, to quote it
+func Excerpt(text string) string {
+	cut := false
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text, cut = text[:i], true
+	}
+	if runes := []rune(text); len(runes) > excerptSize {
+		text, cut = string(runes[:excerptSize]), true
+	}
+	if cut {
+		text += "…"
+	}
+	return text
+}
+
+// Thread returns the records of the thread id belongs to : its root, then
+// every reply in order, along with their depth in the thread
+func Thread(records []Record, id string) ([]Record, []int) {
+	index := make(map[string]int, len(records))
+	for i, r := range records {
+		if r.ID != "" {
+			index[r.ID] = i
+		}
+	}
+
+	i, ok := index[id]
+	if !ok {
+		return nil, nil
+	}
+	for {
+		parent, ok := index[records[i].Parent]
+		if records[i].Parent == "" || !ok {
+			break
+		}
+		i = parent
+	}
+
+	thread, depths := []Record{records[i]}, []int{0}
+	depth := map[string]int{records[i].ID: 0}
+	for _, r := range records[i+1:] {
+		if d, ok := depth[r.Parent]; ok && r.Parent != "" {
+			depth[r.ID] = d + 1
+			thread = append(thread, r)
+			depths = append(depths, d+1)
+		}
+	}
+	return thread, depths
+}
+
+// ErrNotFound is returned when changing a record the Store doesn't have
+var ErrNotFound = errors.New("no such message")
+
+var ids = struct {
+	sync.Mutex
+	last int64
+}{}
+
+// NewID returns a unique record identifier. IDs are hexadecimal timestamps of
+// the same length, so they sort like the records they identify.
+func NewID() string {
+	ids.Lock()
+	defer ids.Unlock()
+
+	n := time.Now().UnixNano()
+	if n <= ids.last {
+		n = ids.last + 1
+	}
+	ids.last = n
+	return fmt.Sprintf("%016x", n)
+}
+
+// IDTime returns the time an ID was made at
+func IDTime(id string) (time.Time, bool) {
+	var n int64
+	if _, err := fmt.Sscanf(id, "%x", &n); err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+// seen makes sure NewID never returns an ID older than id
+func seen(id string) {
+	t, ok := IDTime(id)
+	if !ok {
+		return
+	}
+
+	n := t.UnixNano()
+	ids.Lock()
+	if n > ids.last {
+		ids.last = n
+	}
+	ids.Unlock()
+}
+
+// apply adds r to records, or applies it to the record it changes
+func apply(records []Record, r Record) []Record {
+	if r.Head != EditRecord && r.Head != DeleteRecord && r.Head != ReactionRecord {
+		return append(records, r)
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ID != r.ID {
+			continue
+		}
+
+		switch r.Head {
+		case DeleteRecord:
+			return append(records[:i], records[i+1:]...)
+		case EditRecord:
+			records[i].Content = r.Content
+			records[i].Edited = true
+		case ReactionRecord:
+			fields := strings.Fields(r.Content)
+			if len(fields) > 0 {
+				records[i].Reactions = react(records[i].Reactions, fields[0], fields[1:])
+			}
+		}
+		break
+	}
+	return records
+}
+
+// react returns a copy of reactions where names reacted with reaction, so
+// that the records already returned by a Store don't change
+func react(reactions map[string][]string, reaction string, names []string) map[string][]string {
+	updated := make(map[string][]string, len(reactions)+1)
+	for k, v := range reactions {
+		updated[k] = v
+	}
+
+	if len(names) == 0 {
+		delete(updated, reaction)
+	} else {
+		updated[reaction] = names
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+	return updated
+}
+
+// Store keeps the most recent records in memory, and appends every record to
+// a JSON lines file if it has one. The older records are read back from the
+// file, where the lines of every record are remembered.
+//
+type Store struct {
+	sync.RWMutex
+	records []Record
+	max     int
+	path    string
+	file    *os.File
+
+	// offsets are where the lines of the records and their changes start in
+	// the history file, by record id
+	offsets map[string][]int64
+	size    int64
+}
+
+// NewStore creates a Store keeping up to max records in memory, persisted to
+// path unless it is empty. Existing records of path are loaded.
+func NewStore(path string, max int) (*Store, error) {
+	s := &Store{max: max, path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	records, offsets, err := load(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(records) > max {
+		records = records[len(records)-max:]
+	}
+	s.records = records
+	s.offsets = offsets
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	s.size = info.Size()
+	return s, nil
+}
+
+// Load reads every record of a history file
+func Load(path string) ([]Record, error) {
+	records, _, err := load(path)
+	return records, err
+}
+
+// load reads every record of a history file, and where the lines of the ones
+// still there start
+func load(path string) ([]Record, map[string][]int64, error) {
+	offsets := make(map[string][]int64)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offsets, err
+	}
+	defer f.Close()
+
+	var records []Record
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if len(line) > 0 {
+			var r Record
+			if err := json.Unmarshal(line, &r); err != nil {
+				return nil, nil, errors.New("corrupted history file " + path + " : " + err.Error())
+			}
+			seen(r.ID)
+			records = apply(records, r)
+			track(offsets, r, offset)
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return records, offsets, nil
+		}
+	}
+}
+
+// track remembers the line of r starting at offset, the way apply applies it
+func track(offsets map[string][]int64, r Record, offset int64) {
+	switch {
+	case r.ID == "":
+	case r.Head == DeleteRecord:
+		delete(offsets, r.ID)
+	case r.Head == EditRecord || r.Head == ReactionRecord:
+		if lines, ok := offsets[r.ID]; ok {
+			offsets[r.ID] = append(lines, offset)
+		}
+	default:
+		offsets[r.ID] = []int64{offset}
+	}
+}
+
+// readRecord reads the record of the line starting at offset in f
+func readRecord(f *os.File, offset int64) (Record, error) {
+	var r Record
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return r, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return r, err
+	}
+	return r, json.Unmarshal(line, &r)
+}
+
+// Append adds a record to the Store
+func (s *Store) Append(r Record) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records = append(s.records, r)
+	if len(s.records) > s.max {
+		s.records = s.records[len(s.records)-s.max:]
+	}
+	return s.write(r)
+}
+
+// write appends r to the history file, the lock being held
+func (s *Store) write(r Record) error {
+	if s.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	n, err := s.file.Write(append(line, '\n'))
+	if err == nil {
+		track(s.offsets, r, s.size)
+	}
+	s.size += int64(n)
+	return err
+}
+
+// Get returns the record identified by id, read from the history file if it
+// is no longer in memory. Records the file can't be read back from are
+// missing.
+func (s *Store) Get(id string) (Record, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	r, ok, err := s.find(id)
+	return r, ok && err == nil
+}
+
+// Lookup returns the records identified by ids, in the same order. The ones
+// no longer in memory are read from their lines of the history file, unknown
+// ones skipped.
+func (s *Store) Lookup(ids []string) ([]Record, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var out []Record
+	for _, id := range ids {
+		r, ok, err := s.find(id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// Edit replaces the content of the record identified by id, on behalf of name
+func (s *Store) Edit(id, name, content string) error {
+	return s.change(Record{ID: id, Time: time.Now(), Head: EditRecord, Name: name, Content: content})
+}
+
+// Delete removes the record identified by id, on behalf of name
+func (s *Store) Delete(id, name string) error {
+	return s.change(Record{ID: id, Time: time.Now(), Head: DeleteRecord, Name: name})
+}
+
+// React toggles the reaction of name to the record identified by id, and
+// returns every user who reacted the same way
+func (s *Store) React(id, name, reaction string) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var names []string
+	toggled := false
+	for _, n := range old.Reactions[reaction] {
+		if n == name {
+			toggled = true
+		} else {
+			names = append(names, n)
+		}
+	}
+	if !toggled {
+		names = append(names, name)
+	}
+
+	return names, s.changeLocked(reactionRecord(id, name, reaction, names))
+}
+
+// SetReaction sets the users who reacted to the record identified by id
+func (s *Store) SetReaction(id, reaction string, names []string) error {
+	return s.change(reactionRecord(id, "", reaction, names))
+}
+
+func reactionRecord(id, name, reaction string, names []string) Record {
+	content := strings.Join(append([]string{reaction}, names...), " ")
+	return Record{ID: id, Time: time.Now(), Head: ReactionRecord, Name: name, Content: content}
+}
+
+// find returns the record identified by id, the lock being held. Records no
+// longer in memory are read from their lines of the history file.
+func (s *Store) find(id string) (Record, bool, error) {
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if s.records[i].ID == id {
+			return s.records[i], true, nil
+		}
+	}
+
+	lines, ok := s.offsets[id]
+	if !ok {
+		return Record{}, false, nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return Record{}, false, err
+	}
+	defer f.Close()
+
+	var records []Record
+	for _, offset := range lines {
+		r, err := readRecord(f, offset)
+		if err != nil {
+			return Record{}, false, errors.New("corrupted history file " + s.path + " : " + err.Error())
+		}
+		records = apply(records, r)
+	}
+	if len(records) != 1 {
+		return Record{}, false, nil
+	}
+	return records[0], true, nil
+}
+
+// change applies a change record to a record in memory, and records it
+func (s *Store) change(r Record) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.changeLocked(r)
+}
+
+// changeLocked is change, the lock being held
+func (s *Store) changeLocked(r Record) error {
+	old, ok, err := s.find(r.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	r.Channel = old.Channel
+	s.records = apply(s.records, r)
+	return s.write(r)
+}
+
+// SetMax changes the amount of records kept in memory
+func (s *Store) SetMax(max int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.max = max
+	if len(s.records) > max {
+		s.records = s.records[len(s.records)-max:]
+	}
+}
+
+// Range returns the records of a channel emitted between from and to. Zero
+// times leave the range open, an empty channel matches all of them.
+func (s *Store) Range(channel string, from, to time.Time) []Record {
+	s.RLock()
+	defer s.RUnlock()
+	return Filter(s.records, channel, from, to)
+}
+
+// Stored works as Range among every record of the history file, not only the
+// ones in memory, unless the Store has no file
+func (s *Store) Stored(channel string, from, to time.Time) ([]Record, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.path == "" {
+		return Filter(s.records, channel, from, to), nil
+	}
+	records, err := Load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return Filter(records, channel, from, to), nil
+}
+
+// Close closes the history file of the Store
+func (s *Store) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Filter returns the records of a channel emitted between from and to
+func Filter(records []Record, channel string, from, to time.Time) []Record {
+	var out []Record
+	for _, r := range records {
+		if channel != "" && r.Channel != channel {
+			continue
+		}
+		if !from.IsZero() && r.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && r.Time.After(to) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+var layouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseTime reads the bound of a time range, either as a date with an optional
+// time of the day, or as a time of the current day (15:04 or 15:04:05)
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			y, m, d := time.Now().Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+
+	return time.Time{}, errors.New("invalid time " + s)
+}
@@ -0,0 +1,212 @@
+package history
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDsSort(t *testing.T) {
+	last := NewID()
+	for i := 0; i < 1000; i++ {
+		id := NewID()
+		if id <= last {
+			t.Fatalf("%s isn't after %s", id, last)
+		}
+		last = id
+	}
+
+	if at, ok := IDTime(last); !ok || time.Since(at) > time.Minute {
+		t.Errorf("unexpected time %v of %s", at, last)
+	}
+}
+
+func TestEditDeleteReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	s, err := NewStore(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := NewID(), NewID()
+	s.Append(Record{ID: first, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "helo"})
+	s.Append(Record{ID: second, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "oops"})
+
+	if err := s.Edit(first, "joncena", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(second, "joncena"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(second, "joncena"); err != ErrNotFound {
+		t.Errorf("deleting twice : expected ErrNotFound, got %v", err)
+	}
+	s.Close()
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Content != "hello" || !records[0].Edited {
+		t.Errorf("unexpected records after replay : %+v", records)
+	}
+}
+
+func TestThread(t *testing.T) {
+	records := []Record{
+		{ID: "1", Name: "joncena", Content: "who's up for lunch ?"},
+		{ID: "2", Name: "Springwater64", Content: "unrelated"},
+		{ID: "3", Name: "Springwater64", Content: "me", Parent: "1"},
+		{ID: "4", Name: "joncena", Content: "where ?", Parent: "3"},
+		{ID: "5", Name: "Lobby", Content: "me too", Parent: "1"},
+	}
+
+	thread, depths := Thread(records, "4")
+	var ids []string
+	for _, r := range thread {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, ",") != "1,3,4,5" {
+		t.Errorf("unexpected thread %v", ids)
+	}
+	if fmt.Sprint(depths) != "[0 1 2 1]" {
+		t.Errorf("unexpected depths %v", depths)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if e := Excerpt("short"); e != "short" {
+		t.Errorf("short message changed to %q", e)
+	}
+	if e := Excerpt("first line\nsecond line"); e != "first line…" {
+		t.Errorf("unexpected excerpt %q", e)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	s, _ := NewStore("", 10)
+	id := NewID()
+	s.Append(Record{ID: id, Head: "M", Name: "joncena", Content: "deploy done"})
+
+	s.React(id, "Springwater64", ":+1:")
+	names, err := s.React(id, "joncena", ":+1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "Springwater64,joncena" {
+		t.Errorf("unexpected reactions %v", names)
+	}
+
+	before, _ := s.Get(id)
+	if names, _ = s.React(id, "Springwater64", ":+1:"); strings.Join(names, ",") != "joncena" {
+		t.Errorf("reaction wasn't toggled : %v", names)
+	}
+	if len(before.Reactions[":+1:"]) != 2 {
+		t.Error("reacting changed a record returned earlier")
+	}
+
+	s.React(id, "joncena", ":+1:")
+	if r, _ := s.Get(id); r.Reactions != nil {
+		t.Errorf("unexpected reactions %v", r.Reactions)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	s, err := NewStore(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second, third := NewID(), NewID(), NewID()
+	s.Append(Record{ID: first, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "helo"})
+	s.Edit(first, "joncena", "hello")
+	s.Append(Record{ID: second, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "oops"})
+	s.Delete(second, "joncena")
+	s.Append(Record{ID: third, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "Springwater64", Content: "hi"})
+
+	check := func(s *Store) {
+		records, err := s.Lookup([]string{third, second, first, "unknown"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 || records[0].ID != third || records[1].Content != "hello" || !records[1].Edited {
+			t.Errorf("unexpected records %+v", records)
+		}
+
+		stored, err := s.Stored("ChatRoom", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2 || stored[0].ID != first || stored[1].ID != third {
+			t.Errorf("unexpected stored records %+v", stored)
+		}
+	}
+	check(s)
+	s.Close()
+
+	s, err = NewStore(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check(s)
+}
+
+func TestChangeStoredRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	// only the last record stays in memory
+	s, err := NewStore(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second, third := NewID(), NewID(), NewID()
+	s.Append(Record{ID: first, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "helo"})
+	s.Append(Record{ID: second, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "joncena", Content: "oops"})
+	s.Append(Record{ID: third, Time: time.Now(), Channel: "ChatRoom", Head: "M", Name: "Springwater64", Content: "hi"})
+
+	if err := s.Edit(first, "joncena", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := s.React(first, "Springwater64", ":+1:"); err != nil || strings.Join(names, ",") != "Springwater64" {
+		t.Fatalf("unexpected reaction %v, %v", names, err)
+	}
+	if err := s.Delete(second, "joncena"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(second); ok {
+		t.Error("deleted record is still found")
+	}
+	if r, ok := s.Get(first); !ok || r.Content != "hello" || !r.Edited || len(r.Reactions[":+1:"]) != 1 {
+		t.Errorf("unexpected stored record %+v", r)
+	}
+	s.Close()
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Content != "hello" || records[1].ID != third {
+		t.Errorf("unexpected records after replay : %+v", records)
+	}
+}
@@ -0,0 +1,228 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// minTermSize is the amount of characters of the shortest words indexed
+const minTermSize = 2
+
+// Terms returns the distinct lower case words of a text, the way an Index
+// finds them
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	var terms []string
+	for _, w := range words {
+		if len([]rune(w)) < minTermSize || seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// entry is a record indexed, without its content. A removed record has an
+// entry without terms.
+type entry struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Terms   []string  `json:"terms,omitempty"`
+}
+
+// Query selects the records holding every word of Words. Empty fields and
+// zero times match every record.
+//
+type Query struct {
+	Words   []string
+	Channel string
+	Name    string
+	From    time.Time
+	To      time.Time
+
+	// Allow tells whether the records of a channel may be found, unless nil
+	Allow func(channel string) bool
+}
+
+// Index is an inverted index of the words of records, finding them by word.
+// Its entries are appended to a JSON lines file if it has one, and replayed
+// when it is opened.
+//
+type Index struct {
+	sync.RWMutex
+	entries  map[string]entry
+	postings map[string]map[string]bool
+	file     *os.File
+}
+
+// OpenIndex opens the index saved to path, which may not exist yet. The index
+// is kept in memory only if path is empty.
+func OpenIndex(path string) (*Index, error) {
+	x := &Index{entries: make(map[string]entry), postings: make(map[string]map[string]bool)}
+	if path == "" {
+		return x, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var e entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				return nil, errors.New("corrupted index file " + path + " : " + err.Error())
+			}
+			x.set(e)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	x.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// set replaces the entry of a record, the lock being held
+func (x *Index) set(e entry) {
+	if old, ok := x.entries[e.ID]; ok {
+		for _, t := range old.Terms {
+			delete(x.postings[t], e.ID)
+			if len(x.postings[t]) == 0 {
+				delete(x.postings, t)
+			}
+		}
+		delete(x.entries, e.ID)
+	}
+
+	if len(e.Terms) == 0 {
+		return
+	}
+	x.entries[e.ID] = e
+	for _, t := range e.Terms {
+		if x.postings[t] == nil {
+			x.postings[t] = make(map[string]bool)
+		}
+		x.postings[t][e.ID] = true
+	}
+}
+
+// write indexes e and appends it to the index file
+func (x *Index) write(e entry) error {
+	x.Lock()
+	defer x.Unlock()
+
+	x.set(e)
+	if x.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = x.file.Write(append(line, '\n'))
+	return err
+}
+
+// Add indexes the words of a record, replacing the ones of an edited record
+func (x *Index) Add(r Record) error {
+	return x.write(entry{ID: r.ID, Time: r.Time, Channel: r.Channel, Name: r.Name, Terms: Terms(r.Content)})
+}
+
+// Remove forgets the record identified by id
+func (x *Index) Remove(id string) error {
+	return x.write(entry{ID: id})
+}
+
+// Len returns the amount of records indexed
+func (x *Index) Len() int {
+	x.RLock()
+	defer x.RUnlock()
+	return len(x.entries)
+}
+
+// Search returns the ids of the records matching q, the most recent first
+func (x *Index) Search(q Query) []string {
+	x.RLock()
+	defer x.RUnlock()
+
+	var ids []string
+	match := func(e entry) bool {
+		return (q.Channel == "" || e.Channel == q.Channel) &&
+			(q.Name == "" || e.Name == q.Name) &&
+			(q.From.IsZero() || !e.Time.Before(q.From)) &&
+			(q.To.IsZero() || !e.Time.After(q.To)) &&
+			(q.Allow == nil || q.Allow(e.Channel))
+	}
+
+	if len(q.Words) == 0 {
+		for id, e := range x.entries {
+			if match(e) {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		var words []string
+		for _, w := range q.Words {
+			words = append(words, Terms(w)...)
+		}
+		if len(words) == 0 {
+			return nil
+		}
+
+		// the rarest word has the fewest records to check
+		rarest := words[0]
+		for _, w := range words {
+			if len(x.postings[w]) < len(x.postings[rarest]) {
+				rarest = w
+			}
+		}
+
+	outside:
+		for id := range x.postings[rarest] {
+			for _, w := range words {
+				if !x.postings[w][id] {
+					continue outside
+				}
+			}
+			if match(x.entries[id]) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	// ids sort like the records
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids
+}
+
+// Close closes the index file
+func (x *Index) Close() error {
+	if x.file == nil {
+		return nil
+	}
+	return x.file.Close()
+}
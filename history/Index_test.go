@@ -0,0 +1,63 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerms(t *testing.T) {
+	terms := Terms("Deploy done, deploy-ready? a ÉTÉ")
+	if strings.Join(terms, ",") != "deploy,done,ready,été" {
+		t.Errorf("unexpected terms %v", terms)
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.index")
+
+	x, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2016, 10, 1, 12, 0, 0, 0, time.Local)
+	x.Add(Record{ID: "1", Time: day, Channel: "ChatRoom", Name: "joncena", Content: "deploy is done"})
+	x.Add(Record{ID: "2", Time: day.Add(time.Hour), Channel: "ChatRoom", Name: "Springwater64", Content: "deploy failed"})
+	x.Add(Record{ID: "3", Time: day.AddDate(0, 0, 1), Channel: "Lobby", Name: "joncena", Content: "Deploy again"})
+	x.Add(Record{ID: "2", Time: day.Add(time.Hour), Channel: "ChatRoom", Name: "Springwater64", Content: "deploy works"})
+	x.Remove("3")
+	x.Close()
+
+	x, err = OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+
+	searches := []struct {
+		q   Query
+		ids string
+	}{
+		{Query{Words: []string{"DEPLOY"}}, "2,1"},
+		{Query{Words: []string{"deploy", "done"}}, "1"},
+		{Query{Words: []string{"failed"}}, ""},
+		{Query{Words: []string{"again"}}, ""},
+		{Query{Words: []string{"deploy"}, Name: "joncena"}, "1"},
+		{Query{Words: []string{"deploy"}, From: day.Add(time.Minute)}, "2"},
+		{Query{Channel: "ChatRoom", To: day}, "1"},
+		{Query{Words: []string{"deploy"}, Allow: func(channel string) bool { return channel != "ChatRoom" }}, ""},
+	}
+	for _, s := range searches {
+		if ids := strings.Join(x.Search(s.q), ","); ids != s.ids {
+			t.Errorf("%+v : expected %q, got %q", s.q, s.ids, ids)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/Spriithy/springwater-db/serial"
+)
+
+// Deflate is the capability announced by peers supporting compressed packets.
+// It is appended to the content of the client's JoinHead packet, and echoed
+// in the server's answer when it accepts to compress the packets it sends.
+const Deflate = "deflate"
+
+// CompressionThreshold is the editable minimum size of packet data worth
+// compressing, smaller packets are always sent as is
+// Default value = 256
+var CompressionThreshold = 256
+
+const compressedHead = 'Z'
+
+// IsCompressed tells whether some raw network data is a compressed packet
+func IsCompressed(data []byte) bool {
+	return len(data) > 0 && data[0] == compressedHead
+}
+
+// deflate compresses raw packet data, unless it is too small or doesn't shrink
+// Compressed format : HEAD DATA\r\n
+func deflate(data serial.Data) serial.Data {
+	if len(data) < CompressionThreshold {
+		return data
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{compressedHead, ' '})
+
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	check(err)
+	if _, err = w.Write(data); err != nil {
+		return data
+	}
+	if err = w.Close(); err != nil {
+		return data
+	}
+	buf.WriteString(crlf)
+
+	if buf.Len() >= len(data) {
+		return data
+	}
+	return serial.Data(buf.Bytes())
+}
+
+// inflate returns the raw packet data held by a compressed packet
+func inflate(data []byte) ([]byte, error) {
+	n := len(data)
+	if n < 4 || data[1] != ' ' || string(data[n-2:]) != crlf {
+		return nil, errors.New("malformed compressed packet")
+	}
+
+	// Never inflate more than the biggest valid packet
+	limit := int64(MaxContentSize + metaSize)
+	r := flate.NewReader(bytes.NewReader(data[2 : n-2]))
+	defer r.Close()
+
+	raw, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, ErrContentTooLong
+	}
+
+	if IsCompressed(raw) {
+		return nil, errors.New("nested compressed packet")
+	}
+	return raw, nil
+}
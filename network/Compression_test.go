@@ -0,0 +1,45 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressedFrames(t *testing.T) {
+	content := strings.Repeat("2016/11/18 12:00:00 GET /index.html 200\n", 100)
+	p, err := UserPacket(ChunkHead, "", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := Frames(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || !IsCompressed(frames[0]) {
+		t.Fatal("packet should fit in a single compressed frame")
+	}
+
+	q, err := Parse(frames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Header() != ChunkHead || q.Content() != content {
+		t.Error("inflated packet doesn't match the original")
+	}
+}
+
+func TestSmallPacketsStayRaw(t *testing.T) {
+	p, err := UserPacket(MessageHead, "", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := Frames(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || string(frames[0]) != p.String() {
+		t.Error("packets below CompressionThreshold shouldn't be compressed")
+	}
+}
@@ -0,0 +1,179 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// End-to-end encrypted whispers
+//
+// - Each user owns an X25519 KeyPair and publishes its public key to the server
+// with a KeyHead packet. Public keys are base64 encoded.
+//
+// - A sealed message is the content of a whisper that only its recipient can
+// read, the server relays it as an opaque blob :
+//  	e2e SENDERKEY NONCE|CIPHERTEXT
+//  	NONCE|CIPHERTEXT is base64 encoded, sealed with AES-GCM using the
+//  	SHA-256 of the X25519 shared secret and both public keys
+//
+
+const sealPrefix = "e2e "
+
+// ErrInvalidKey is returned when a public key cannot be decoded
+var ErrInvalidKey = errors.New("invalid public key")
+
+// KeyPair is the X25519 key pair of a user
+//
+type KeyPair struct {
+	private *ecdh.PrivateKey
+}
+
+// GenerateKeyPair creates a new random KeyPair
+func GenerateKeyPair() (*KeyPair, error) {
+	k, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{k}, nil
+}
+
+// LoadKeyPair restores a KeyPair from the bytes of its private key
+func LoadKeyPair(raw []byte) (*KeyPair, error) {
+	k, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{k}, nil
+}
+
+// Bytes returns the private key, to be stored by its owner only
+func (k *KeyPair) Bytes() []byte {
+	return k.private.Bytes()
+}
+
+// PublicKey returns the encoded public key of the KeyPair
+func (k *KeyPair) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.private.PublicKey().Bytes())
+}
+
+func parsePublicKey(key string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return pub, nil
+}
+
+// CheckPublicKey tells whether an encoded public key is valid
+func CheckPublicKey(key string) error {
+	_, err := parsePublicKey(key)
+	return err
+}
+
+// Fingerprint returns a short human readable digest of a public key, meant to
+// be compared out of band
+func Fingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:16])
+
+	groups := make([]string, 0, len(digest)/4)
+	for i := 0; i < len(digest); i += 4 {
+		groups = append(groups, digest[i:i+4])
+	}
+	return strings.Join(groups, ":")
+}
+
+// IsSealed tells whether a whisper content is a sealed message
+func IsSealed(content string) bool {
+	return strings.HasPrefix(content, sealPrefix)
+}
+
+// aead derives the cipher shared by the owner of k and the owner of peer
+func (k *KeyPair) aead(peer *ecdh.PublicKey, sender, recipient []byte) (cipher.AEAD, error) {
+	secret, err := k.private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(secret)
+	h.Write(sender)
+	h.Write(recipient)
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts a message that only the owner of the peer public key can open
+func (k *KeyPair) Seal(peer string, message string) (string, error) {
+	pub, err := parsePublicKey(peer)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := k.aead(pub, k.private.PublicKey().Bytes(), pub.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(message), nil)
+	return sealPrefix + k.PublicKey() + " " + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed message, returning the sender's public key along with
+// the message. The caller is responsible for checking that key.
+func (k *KeyPair) Open(content string) (string, string, error) {
+	if !IsSealed(content) {
+		return "", "", errors.New("message is not sealed")
+	}
+
+	fields := strings.SplitN(content[len(sealPrefix):], " ", 2)
+	if len(fields) != 2 {
+		return "", "", errors.New("malformed sealed message")
+	}
+
+	pub, err := parsePublicKey(fields[0])
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", "", errors.New("malformed sealed message")
+	}
+
+	gcm, err := k.aead(pub, pub.Bytes(), k.private.PublicKey().Bytes())
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", "", errors.New("malformed sealed message")
+	}
+
+	message, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", "", errors.New("sealed message could not be authenticated")
+	}
+	return fields[0], string(message), nil
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func keyPairs(t *testing.T, n int) []*KeyPair {
+	keys := make([]*KeyPair, n)
+	for i := range keys {
+		k, err := GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = k
+	}
+	return keys
+}
+
+func TestSealOpen(t *testing.T) {
+	keys := keyPairs(t, 3)
+	alice, bob, eve := keys[0], keys[1], keys[2]
+
+	sealed, err := alice.Seal(bob.PublicKey(), "meet me at 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "meet me") {
+		t.Fatalf("message isn't sealed : %q", sealed)
+	}
+
+	from, message, err := bob.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != alice.PublicKey() || message != "meet me at 5" {
+		t.Errorf("unexpected message %q from %q", message, from)
+	}
+
+	if _, _, err := eve.Open(sealed); err == nil {
+		t.Error("a sealed message was opened by another recipient")
+	}
+	if _, _, err := alice.Open(sealed); err == nil {
+		t.Error("a sealed message was opened by its sender")
+	}
+}
+
+func TestTamperedSeal(t *testing.T) {
+	keys := keyPairs(t, 3)
+	alice, bob, eve := keys[0], keys[1], keys[2]
+
+	sealed, err := alice.Seal(bob.PublicKey(), "meet me at 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(sealed[len(sealPrefix):], " ", 2)
+	raw, _ := base64.StdEncoding.DecodeString(fields[1])
+
+	// flips a bit of the nonce, then of the ciphertext
+	for _, i := range []int{0, len(raw) - 1} {
+		tampered := append([]byte(nil), raw...)
+		tampered[i] ^= 1
+		content := sealPrefix + fields[0] + " " + base64.StdEncoding.EncodeToString(tampered)
+		if _, _, err := bob.Open(content); err == nil {
+			t.Errorf("a message tampered at byte %d was opened", i)
+		}
+	}
+
+	// another sender claiming the message
+	if _, _, err := bob.Open(sealPrefix + eve.PublicKey() + " " + fields[1]); err == nil {
+		t.Error("a message was opened with the key of another sender")
+	}
+
+	for _, content := range []string{"hello", sealPrefix + "nokey", sealPrefix + fields[0] + " !!", sealPrefix + fields[0] + " AAAA"} {
+		if _, _, err := bob.Open(content); err == nil {
+			t.Errorf("malformed message %q was opened", content)
+		}
+	}
+}
+
+func TestLoadKeyPair(t *testing.T) {
+	k := keyPairs(t, 1)[0]
+
+	loaded, err := LoadKeyPair(k.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Bytes(), k.Bytes()) || loaded.PublicKey() != k.PublicKey() {
+		t.Error("loaded key pair doesn't match the saved one")
+	}
+
+	if _, err := LoadKeyPair([]byte("short")); err == nil {
+		t.Error("a truncated private key was loaded")
+	}
+	if err := CheckPublicKey(k.PublicKey()); err != nil {
+		t.Error(err)
+	}
+	if err := CheckPublicKey("not a key"); err != ErrInvalidKey {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/springwater-db/serial"
+)
+
+// FragmentTimeout is the editable delay after which a partially received
+// packet is dropped
+// Default value = 30s
+var FragmentTimeout = 30 * time.Second
+
+// MaxPartialPackets is the editable amount of packets a client may have
+// partially received at once, its other fragmented packets being dropped
+// Default value = 8
+var MaxPartialPackets = 8
+
+// fragMetaSize is the size of a fragment without its id and payload
+var fragMetaSize = 6 + 2*2 // SEQ and TOTAL are uint16
+
+// IsFragment tells whether some raw network data is a packet fragment
+func IsFragment(data []byte) bool {
+	return len(data) > 0 && data[0] == fragmentHead
+}
+
+// fragmentOwner returns the owner of the fragments of p : the id of the client
+// sending it, the first field of its content. Server and join packets have
+// none.
+func fragmentOwner(p Packet) string {
+	if p.Header() == ServerHead || p.Header() == JoinHead {
+		return ""
+	}
+	return strings.SplitN(p.Content(), " ", 2)[0]
+}
+
+// FragmentOwner returns the id of the client which packet a fragment belongs
+// to, empty if it has none
+func FragmentOwner(data []byte) string {
+	if !IsFragment(data) || len(data) < 2 {
+		return ""
+	}
+
+	id := data[2:]
+	if end := bytes.IndexByte(id, ' '); end >= 0 {
+		id = id[:end]
+	}
+	if i := bytes.IndexByte(id, '/'); i >= 0 {
+		return string(id[:i])
+	}
+	return ""
+}
+
+// fragment splits raw packet data into fragments that fit in MaxPacketSize,
+// their id telling the owner of the packet if any
+func fragment(data serial.Data, owner string) ([]serial.Data, error) {
+	id := []byte(uuid.NextUUID())
+	if owner != "" {
+		id = []byte(owner + "/" + string(id))
+	}
+
+	size := MaxPacketSize - fragMetaSize - len(id)
+	if size <= 0 {
+		return nil, errors.New("MaxPacketSize is too small to fragment packets")
+	}
+
+	total := (len(data) + size - 1) / size
+	if total > 0xffff {
+		return nil, ErrContentTooLong
+	}
+
+	frames := make([]serial.Data, 0, total)
+	for seq := 0; seq < total; seq++ {
+		payload := data[seq*size:]
+		if len(payload) > size {
+			payload = payload[:size]
+		}
+
+		frame := make(serial.Data, fragMetaSize+len(id)+len(payload))
+		ptr := frame.WriteBytes(0, []byte{fragmentHead, ' '})
+		ptr = frame.WriteBytes(ptr, id)
+		ptr = frame.WriteByte(ptr, ' ')
+		binary.BigEndian.PutUint16(frame[ptr:], uint16(seq))
+		binary.BigEndian.PutUint16(frame[ptr+2:], uint16(total))
+		ptr = frame.WriteByte(ptr+4, ' ')
+		ptr = frame.WriteBytes(ptr, payload)
+		frame.WriteBytes(ptr, []byte(crlf))
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// Frames returns the raw data to send over the network for the given Packet,
+// compressed if compress is set and fragmented if it doesn't fit in
+// MaxPacketSize
+func Frames(p Packet, compress bool) ([][]byte, error) {
+	data := serial.Data(p.String())
+	if compress {
+		data = deflate(data)
+	}
+
+	if len(data) <= MaxPacketSize {
+		return [][]byte{data}, nil
+	}
+
+	frames, err := fragment(data, fragmentOwner(p))
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([][]byte, len(frames))
+	for i, f := range frames {
+		raw[i] = f
+	}
+	return raw, nil
+}
+
+type partial struct {
+	frames [][]byte
+	count  int
+	size   int
+	since  time.Time
+}
+
+// Reassembler collects packet fragments until the original packet is complete
+//
+type Reassembler struct {
+	sync.Mutex
+	timeout time.Duration
+
+	// parts are the packets partially received, by sender then packet id
+	parts map[string]map[string]*partial
+}
+
+// NewReassembler creates a Reassembler dropping partial packets after timeout
+func NewReassembler(timeout time.Duration) *Reassembler {
+	return &Reassembler{timeout: timeout, parts: make(map[string]map[string]*partial)}
+}
+
+// Sender returns the host of the fragments received from addr, as the fragments
+// of a packet are sent through several connections. Hosts may be shared by
+// several clients, told apart by FragmentOwner.
+func Sender(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// maxFragments returns the amount of fragments of the largest packet, the
+// fragments of which have an id of the given size
+func maxFragments(idSize int) int {
+	size := MaxPacketSize - fragMetaSize - idSize
+	if size <= 0 {
+		return 0
+	}
+	return (MaxContentSize + metaSize + size - 1) / size
+}
+
+// Add registers a fragment sent by from, which tells the sender apart from the
+// others, ie. its host and the owner of the fragment. The raw data of the
+// original packet is returned once all of its fragments have been received,
+// nil otherwise.
+func (r *Reassembler) Add(from string, data []byte) ([]byte, error) {
+	n := len(data)
+	if !IsFragment(data) || n < fragMetaSize || data[1] != ' ' || string(data[n-2:]) != crlf {
+		return nil, errors.New("malformed fragment")
+	}
+
+	// ID is delimited by the space following it
+	end := 2
+	for end < n && data[end] != ' ' {
+		end++
+	}
+	if end+6 > n-2 || data[end+5] != ' ' {
+		return nil, errors.New("malformed fragment")
+	}
+
+	id := string(data[2:end])
+	seq := int(binary.BigEndian.Uint16(data[end+1:]))
+	total := int(binary.BigEndian.Uint16(data[end+3:]))
+	payload := data[end+6 : n-2]
+
+	if total == 0 || seq >= total {
+		return nil, errors.New("fragment sequence out of bounds")
+	}
+	if total > maxFragments(len(id)) {
+		return nil, ErrContentTooLong
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.prune(from, now)
+	parts := r.parts[from]
+
+	p, ok := parts[id]
+	if !ok {
+		if len(parts) >= MaxPartialPackets {
+			return nil, errors.New("too many partial packets")
+		}
+		if parts == nil {
+			parts = make(map[string]*partial)
+			r.parts[from] = parts
+		}
+		p = &partial{frames: make([][]byte, total), since: now}
+		parts[id] = p
+	}
+
+	if len(p.frames) != total {
+		r.drop(from, id)
+		return nil, errors.New("fragment count mismatch")
+	}
+
+	if p.frames[seq] != nil {
+		return nil, nil // duplicate
+	}
+
+	p.size += len(payload)
+	if p.size > MaxContentSize+metaSize {
+		r.drop(from, id)
+		return nil, ErrContentTooLong
+	}
+
+	p.frames[seq] = append([]byte(nil), payload...)
+	p.count++
+
+	if p.count < total {
+		return nil, nil
+	}
+
+	r.drop(from, id)
+	buf := make([]byte, 0, p.size)
+	for _, f := range p.frames {
+		buf = append(buf, f...)
+	}
+
+	return buf, nil
+}
+
+// drop forgets a partial packet of from, the lock being held
+func (r *Reassembler) drop(from, id string) {
+	delete(r.parts[from], id)
+	if len(r.parts[from]) == 0 {
+		delete(r.parts, from)
+	}
+}
+
+// prune drops the partial packets of from older than the timeout, the lock
+// being held
+func (r *Reassembler) prune(from string, now time.Time) {
+	for id, p := range r.parts[from] {
+		if now.Sub(p.since) > r.timeout {
+			r.drop(from, id)
+		}
+	}
+}
+
+// Prune drops every partial packet older than the timeout. Senders' packets
+// are pruned when they send fragments, Prune catches the ones who stopped.
+func (r *Reassembler) Prune() {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for from := range r.parts {
+		r.prune(from, now)
+	}
+}
+
+// Pending returns the amount of packets waiting for fragments
+func (r *Reassembler) Pending() int {
+	r.Lock()
+	defer r.Unlock()
+
+	n := 0
+	for _, parts := range r.parts {
+		n += len(parts)
+	}
+	return n
+}
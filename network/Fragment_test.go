@@ -0,0 +1,123 @@
+package network
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFragmentReassembly(t *testing.T) {
+	content := strings.Repeat("all work and no play makes jack a dull boy ", 200)
+	p, err := UserPacket(MessageHead, "", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := fragment([]byte(p.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) < 2 {
+		t.Fatalf("expected several fragments, got %d", len(frames))
+	}
+
+	r := NewReassembler(time.Minute)
+	var data []byte
+	// deliver out of order
+	for i := len(frames) - 1; i >= 0; i-- {
+		if len(frames[i]) > MaxPacketSize {
+			t.Errorf("fragment %d is larger than MaxPacketSize", i)
+		}
+		if data, err = r.Add("127.0.0.1", frames[i]); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && data != nil {
+			t.Fatal("packet reassembled before all fragments were received")
+		}
+	}
+
+	q, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Header() != MessageHead || q.Content() != content {
+		t.Error("reassembled packet doesn't match the original")
+	}
+	if r.Pending() != 0 {
+		t.Error("reassembler still holds a complete packet")
+	}
+}
+
+func TestContentCeiling(t *testing.T) {
+	content := strings.Repeat("x", MaxContentSize+1)
+	if _, err := ServerPacket(SuccessCode, content); err != ErrContentTooLong {
+		t.Error("ServerPacket accepted content above MaxContentSize")
+	}
+	if _, err := UserPacket(MessageHead, "", content); err != ErrContentTooLong {
+		t.Error("UserPacket accepted content above MaxContentSize")
+	}
+}
+
+func TestReassemblerLimits(t *testing.T) {
+	// two clients behind the same host
+	packet := func(owner string) Packet {
+		p, err := UserPacket(MessageHead, "", owner+" "+strings.Repeat("x", MaxContentSize/2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	frames, err := Frames(packet("joncena"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := FragmentOwner(frames[0]); owner != "joncena" {
+		t.Fatalf("unexpected fragment owner %q", owner)
+	}
+	sender := func(frame []byte) string {
+		return "127.0.0.1 " + FragmentOwner(frame)
+	}
+
+	r := NewReassembler(time.Minute)
+	// TOTAL follows the space after the id, and SEQ
+	forged := append([]byte(nil), frames[0]...)
+	end := 2 + strings.IndexByte(string(forged[2:]), ' ')
+	binary.BigEndian.PutUint16(forged[end+3:], 0xffff)
+	if _, err := r.Add(sender(forged), forged); err != ErrContentTooLong {
+		t.Errorf("expected ErrContentTooLong for 65535 fragments, got %v", err)
+	}
+
+	// joncena holds as many partial packets as allowed, told apart by the
+	// uuid of their id
+	for i := 0; i <= MaxPartialPackets; i++ {
+		frame := append([]byte(nil), frames[0]...)
+		frame[len("F joncena/")] = byte('a' + i)
+		_, err := r.Add(sender(frame), frame)
+		if i < MaxPartialPackets && err != nil {
+			t.Fatal(err)
+		}
+		if i == MaxPartialPackets && err == nil {
+			t.Error("accepted more than MaxPartialPackets partial packets")
+		}
+	}
+
+	// while its neighbour still sends large packets
+	var data []byte
+	neighbour, _ := Frames(packet("Springwater64"), false)
+	for _, frame := range neighbour {
+		if data, err = r.Add(sender(frame), frame); err != nil {
+			t.Fatalf("the neighbour of a client is limited too : %v", err)
+		}
+	}
+	if data == nil {
+		t.Error("the packet of the neighbour wasn't reassembled")
+	}
+
+	r.timeout = 0
+	time.Sleep(time.Millisecond)
+	r.Prune()
+	if r.Pending() != 0 {
+		t.Errorf("%d partial packets weren't pruned", r.Pending())
+	}
+}
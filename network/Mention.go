@@ -0,0 +1,35 @@
+package network
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Mentions returns the names mentioned in a message as @name, once each and
+// in order. Punctuation following a name, as in "@bob, hi", is ignored.
+func Mentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Fields(text) {
+		if len(field) < 2 || field[0] != '@' {
+			continue
+		}
+
+		name := strings.TrimRightFunc(field[1:], unicode.IsPunct)
+		if ok, _ := checkUsername(name); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Mentioned tells whether a message mentions name
+func Mentioned(text, name string) bool {
+	for _, n := range Mentions(text) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
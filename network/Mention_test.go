@@ -0,0 +1,17 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	names := Mentions("@joncena, @Springwater64: lunch ? cc @joncena me@home @x @")
+	if strings.Join(names, ",") != "joncena,Springwater64" {
+		t.Errorf("unexpected mentions %v", names)
+	}
+
+	if !Mentioned("hi @joncena!", "joncena") || Mentioned("hi joncena", "joncena") {
+		t.Error("Mentioned doesn't match Mentions")
+	}
+}
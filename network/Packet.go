@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"net"
+	"strconv"
 	"unicode"
 
 	"github.com/Spriithy/go-uuid"
@@ -15,34 +16,94 @@ import (
 // Packet format over the gochat-term protocol
 //
 // - There are several valid Packet types :
-//  	-> C|D for ConnectionPacket : connection status of clients, disconnections etc
+//  	-> J|L for ConnectionPacket : Clients joining and leaving the Server
 //  	-> M|W for MessagePacket	: Messages and Whispers sent through the Server
+//  	-> R   for replies			: Channel messages replying to another one
+//  	-> U   for reactions		: Reactions to channel messages, ie. :+1:
+//  	-> N   for mentions			: Notifications of the users mentioned as @name
+//  	-> H   for topics			: Topics of the channels
+//  	-> E|D for edits			: Edits and deletions of channel messages
+//  	-> O|A|X for file transfers : Offers, answers and file chunks relayed by the Server
+//  	-> K   for KeyPacket		: Public keys of end-to-end encrypted whispers
+//  	-> C   for commands			: Commands run by the server and its plugins
+//  	-> P   for presence			: Online, away, idle... status of the users
+//  	-> T   for typing			: Users typing in the channel or a whisper
+//  	-> V   for read markers		: Last channel message read by the users
 //  	-> S   for ServerPacket 	: Server info (ie. restart, commands results)
+//  	-> F   for fragments		: Slices of packets larger than MaxPacketSize
+//  	-> Z   for compression		: DEFLATE compressed packets (see Compression.go)
 //
 // - ID is a general purpose UUID formatted as (xxxxxxxx-xxxx-xxxx-xxxxxxxxxxxxxxxx)
 // in hexadecimal digits (see uuid.UUID at gtihub.com/Spriithy/go-uuid)
 //
+// - MSGID is the server-assigned identifier of a channel message, 16
+// hexadecimal digits sorting like the messages (see history.NewID)
+//
 // - CODE is one of :
 //  	-> 0x0 : success
 //  	-> 0x1 : permission error
 //  	-> 0x2 : server quit, restart
+//  	-> 0x3 : request error
 //
 // - User
 //  	HEAD MMSS CONTENT\r\n
 //      Content format for :
-//  		-> Channel message	: ID MESSAGE
-//  		-> Whisper message	: ID to MESSAGE
-//  		-> Connection    	:
+//  		-> Channel message	: ID MESSAGE, relayed as MSGID NAME MESSAGE
+//  		-> Reply			: ID PARENT MESSAGE, relayed as MSGID NAME PARENT MESSAGE
+//  		-> Reaction			: ID MSGID REACTION toggles the reaction of the user,
+//  							  relayed as MSGID REACTION [NAMES...] of every user who reacted so
+//  		-> Mention			: MSGID FROM CHANNEL MESSAGE, sent by the server only
+//  		-> Topic			: CHANNEL SETTER UNIXTIME [TOPIC], sent by the server only
+//  		-> Message edit		: ID MSGID MESSAGE, relayed as MSGID NAME MESSAGE
+//  		-> Message deletion	: ID MSGID, relayed as MSGID NAME
+//  		-> Whisper message	: ID to MESSAGE, relayed as FROM MESSAGE
+//  		-> Connection    	: NAME [deflate] [listen=PATH] [key=PASSWORD], answered with ID [deflate]
+//  		-> Disconnection	: ID
+//  		-> File offer		: ID to FILEID SIZE SHA256 NAME
+//  		-> Offer answer		: ID FILEID yes|no
+//  		-> File chunk		: ID FILEID OFFSET DATA
+//  		-> Key publication	: ID publish KEY
+//  		-> Key lookup		: ID lookup NAME, answered with NAME KEY
+//  		-> Command			: ID NAME [ARGS...], answered with a ServerPacket
+//  		-> Presence			: ID STATUS [NOTE], relayed as NAME STATUS [NOTE]
+//  		-> Typing			: ID [to], relayed as NAME [whisper]
+//  		-> Read marker		: ID MSGID marks the channel read up to MSGID, relayed as NAME MSGID.
+//  							  Joining users are told NAME MSGID UNREAD, and ask for the
+//  							  unread messages with ID alone
 // - Server
 //  	HEAD CODE MMSS CONTENT\r\n
 //
+// - Fragment
+//  	HEAD ID SEQTOTAL PAYLOAD\r\n
+//  	ID is OWNER/UUID, OWNER being the ID of the client sending the packet,
+//  	or UUID alone for the packets of the server and join packets
+//  	SEQ and TOTAL are big-endian uint16, PAYLOAD is a slice of the
+//  	original packet data (see Fragment.go)
+//
 
 var format = fmt.Sprintf
 
 // MaxPacketSize is the editable maximum size for packet content process
+// Packets that do not fit are split into fragments when transferred
 // Default value = 1024
 var MaxPacketSize = 1 << 10
 
+// MaxContentSize is the editable hard ceiling on the content of any Packet,
+// fragmented or not
+// Default value = 65536
+var MaxContentSize = 1 << 16
+
+// ListenCapability is announced in their join packet by the clients of a Unix
+// domain socket, followed by the path of the socket they listen at
+const ListenCapability = "listen="
+
+// KeyCapability is announced in their join packet by the clients giving the
+// password of the channel, followed by the password
+const KeyCapability = "key="
+
+// ErrContentTooLong is returned when a Packet content exceeds MaxContentSize
+var ErrContentTooLong = errors.New("content too long")
+
 const crlf = "\r\n"
 
 func check(e error) {
@@ -51,6 +112,13 @@ func check(e error) {
 	}
 }
 
+func checkContent(content string) error {
+	if len(content) > MaxContentSize {
+		return ErrContentTooLong
+	}
+	return nil
+}
+
 func checkUsername(name string) (bool, error) {
 	if len(name) < 3 || len(name) > 16 {
 		return false, errors.New("src username is either too long or too short (min:3,max:16)")
@@ -71,13 +139,83 @@ func checkUsername(name string) (bool, error) {
 
 const (
 	invalidHead = byte(iota)
-	joinHead    = 'J'
-	leaveHead   = 'L'
-	messageHead = 'M'
-	whisperHead = 'W'
-	serverHead  = 'S'
+
+	// JoinHead is the header of a client's connection Packet
+	JoinHead = 'J'
+
+	// LeaveHead is the header of a client's disconnection Packet
+	LeaveHead = 'L'
+
+	// MessageHead is the header of a channel message
+	MessageHead = 'M'
+
+	// WhisperHead is the header of a private message between two users
+	WhisperHead = 'W'
+
+	// OfferHead is the header of a file transfer offer
+	OfferHead = 'O'
+
+	// AcceptHead is the header of the answer to a file transfer offer
+	AcceptHead = 'A'
+
+	// ChunkHead is the header of a slice of a transferred file
+	ChunkHead = 'X'
+
+	// KeyHead is the header of public key publications and lookups
+	KeyHead = 'K'
+
+	// CommandHead is the header of the commands run by the server, answered
+	// with a ServerPacket
+	CommandHead = 'C'
+
+	// PresenceHead is the header of the status changes of users (see
+	// Presence.go)
+	PresenceHead = 'P'
+
+	// TypingHead is the header of the ephemeral notifications of users
+	// typing, which are never recorded
+	TypingHead = 'T'
+
+	// ReplyHead is the header of the channel messages replying to another
+	ReplyHead = 'R'
+
+	// ReactionHead is the header of the reactions to channel messages (see
+	// Reaction.go)
+	ReactionHead = 'U'
+
+	// MentionHead is the header of the notifications of users mentioned as
+	// @name in a channel message (see Mention.go)
+	MentionHead = 'N'
+
+	// TopicHead is the header of the topics of channels, sent on join and
+	// when they change
+	TopicHead = 'H'
+
+	// EditHead is the header of the edits of channel messages
+	EditHead = 'E'
+
+	// DeleteHead is the header of the deletions of channel messages
+	DeleteHead = 'D'
+
+	// ReadHead is the header of the read markers of users, the last channel
+	// message they read (see server/Read.go)
+	ReadHead = 'V'
+
+	// ServerHead is the header of any ServerPacket
+	ServerHead = 'S'
+
+	fragmentHead = 'F'
 )
 
+func isUserHead(kind byte) bool {
+	switch kind {
+	case MessageHead, WhisperHead, JoinHead, LeaveHead, OfferHead, AcceptHead, ChunkHead, KeyHead, CommandHead, PresenceHead, TypingHead, ReplyHead, ReactionHead, MentionHead, TopicHead, EditHead, DeleteHead, ReadHead:
+		return true
+	default:
+		return false
+	}
+}
+
 const (
 	minCode = '0' - 1
 	// SuccessCode is the code returned by the server if it didn't encounter any issue
@@ -90,6 +228,10 @@ const (
 	// ShutdownCode is the code used by the server to notify about its shutdown process
 	ShutdownCode = '2'
 
+	// RequestErrorCode is used by the server to tell a client its request was
+	// invalid or could not be fulfilled
+	RequestErrorCode = '3'
+
 	maxCode = '9' + 1
 )
 
@@ -119,7 +261,7 @@ type serverPacket struct {
 	data          serial.Data
 }
 
-var metaSize = 5 + 2*serial.GetSize(serial.UInt8)
+var metaSize = 7 + 2*serial.GetSize(serial.UInt8)
 
 // ServerPacket creates a server-emmitable packet ready to be sent of the network
 func ServerPacket(code byte, content string) (Packet, error) {
@@ -127,13 +269,13 @@ func ServerPacket(code byte, content string) (Packet, error) {
 		return nil, errors.New("server code out of bounds")
 	}
 
-	if len(content)+metaSize > MaxPacketSize {
-		return nil, errors.New("content too long")
+	if err := checkContent(content); err != nil {
+		return nil, err
 	}
 
 	t := time.Now()
 	data := make(serial.Data, len(content)+metaSize)
-	ptr := data.WriteBytes(0, []byte{serverHead, ' ', code, ' '})
+	ptr := data.WriteBytes(0, []byte{ServerHead, ' ', code, ' '})
 
 	to := ptr
 	ptr = data.WriteUInt8(ptr, uint8(t.Minute()))
@@ -149,6 +291,79 @@ func ServerPacket(code byte, content string) (Packet, error) {
 	return &serverPacket{to, co, cr, data}, nil
 }
 
+// Parse reads a Packet back from its raw network representation
+func Parse(data []byte) (Packet, error) {
+	if IsCompressed(data) {
+		var err error
+		if data, err = inflate(data); err != nil {
+			return nil, err
+		}
+	}
+
+	n := len(data)
+	if n < 2 || string(data[n-2:]) != crlf {
+		return nil, errors.New("malformed packet")
+	}
+
+	switch {
+	case data[0] == ServerHead:
+		if n < metaSize || data[1] != ' ' || data[3] != ' ' {
+			return nil, errors.New("malformed ServerPacket")
+		}
+		if data[2] <= minCode || data[2] >= maxCode {
+			return nil, errors.New("server code out of bounds")
+		}
+		if n-metaSize > MaxContentSize {
+			return nil, ErrContentTooLong
+		}
+		return &serverPacket{4, 7, n - 2, serial.Data(data)}, nil
+	case isUserHead(data[0]):
+		if n < userMetaSize || data[1] != ' ' {
+			return nil, errors.New("malformed UserPacket")
+		}
+		if n-userMetaSize > MaxContentSize {
+			return nil, ErrContentTooLong
+		}
+		return &userPacket{2, 5, n - 2, data[0], uuid.UUID(""), serial.Data(data)}, nil
+	default:
+		return nil, errors.New("invalid Packet header")
+	}
+}
+
+// Send transfers a Packet over TCP to a given adress. It is compressed first
+// if compress is set, and split into fragments if it doesn't fit in
+// MaxPacketSize
+func Send(p Packet, addr string, port int, compress bool) error {
+	return SendTo(p, "tcp", net.JoinHostPort(addr, strconv.Itoa(port)), compress)
+}
+
+// SendTo works as Send over any network accepted by net.Dial, ie. unix
+func SendTo(p Packet, network, addr string, compress bool) error {
+	frames, err := Frames(p, compress)
+	if err != nil {
+		return err
+	}
+
+	for _, frame := range frames {
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return err
+		}
+
+		n, err := conn.Write(frame)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+
+		if n != len(frame) { // edgy case really
+			return errors.New("message was sent uncomplete")
+		}
+	}
+
+	return nil
+}
+
 func (p *serverPacket) Header() byte {
 	return p.data[0]
 }
@@ -165,24 +380,7 @@ func (p *serverPacket) Content() string {
 }
 
 func (p *serverPacket) Transfer(addr string, port int) error {
-	var err error
-
-	conn, err := net.Dial("tcp", format("%s:%d", addr, port))
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	n, err := conn.Write([]byte(p.data))
-	if err != nil {
-		return err
-	}
-
-	if n != len(p.data) { // edgy case really
-		return errors.New("message was sent uncomplete")
-	}
-
-	return nil
+	return Send(p, addr, port, false)
 }
 
 func (p *serverPacket) String() string {
@@ -198,7 +396,7 @@ type userPacket struct {
 	data          serial.Data
 }
 
-var userMetaSize = 7 + 2*serial.GetSize(serial.UInt8)
+var userMetaSize = 5 + 2*serial.GetSize(serial.UInt8)
 
 // UserPacket is used to wrap the data of a UserPacket over the network
 func UserPacket(kind byte, owner uuid.UUID, content string) (Packet, error) {
@@ -206,7 +404,11 @@ func UserPacket(kind byte, owner uuid.UUID, content string) (Packet, error) {
 		owner = uuid.NextUUID()
 	}
 
-	data := make(serial.Data, MaxPacketSize)
+	if err := checkContent(content); err != nil {
+		return nil, err
+	}
+
+	data := make(serial.Data, len(content)+userMetaSize)
 
 	t := time.Now()
 	ptr := data.WriteByte(0, kind)
@@ -223,12 +425,11 @@ func UserPacket(kind byte, owner uuid.UUID, content string) (Packet, error) {
 	cr := ptr
 	ptr = data.WriteBytes(ptr, []byte(crlf))
 
-	switch kind {
-	case messageHead, whisperHead, joinHead, leaveHead:
-		return &userPacket{to, co, cr, kind, owner, data}, nil
-	default:
+	if !isUserHead(kind) {
 		return nil, errors.New("invalid UserPacket kind")
 	}
+
+	return &userPacket{to, co, cr, kind, owner, data}, nil
 }
 
 func (p *userPacket) Header() byte {
@@ -247,24 +448,7 @@ func (p *userPacket) Content() string {
 }
 
 func (p *userPacket) Transfer(addr string, port int) error {
-	var err error
-
-	conn, err := net.Dial("tcp", format("%s:%d", addr, port))
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	n, err := conn.Write([]byte(p.data))
-	if err != nil {
-		return err
-	}
-
-	if n != len(p.data) { // edgy case really
-		return errors.New("message was sent uncomplete")
-	}
-
-	return nil
+	return Send(p, addr, port, false)
 }
 
 func (p *userPacket) String() string {
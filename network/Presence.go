@@ -0,0 +1,24 @@
+package network
+
+// Presence states of the users, relayed by PresenceHead packets
+const (
+	// Online users are connected and active
+	Online = "online"
+
+	// Away users may leave a note, whispers to them are auto-replied
+	Away = "away"
+
+	// DoNotDisturb users still receive whispers, their senders are warned
+	DoNotDisturb = "dnd"
+
+	// Idle users haven't sent anything for a while, set by the server
+	Idle = "idle"
+
+	// Offline users left the server, set by the server
+	Offline = "offline"
+)
+
+// IsSettableStatus tells whether users may set their status to s themselves
+func IsSettableStatus(s string) bool {
+	return s == Online || s == Away || s == DoNotDisturb
+}
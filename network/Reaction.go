@@ -0,0 +1,43 @@
+package network
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxShortcodeSize is the maximum size of the name of a :shortcode: reaction
+const MaxShortcodeSize = 32
+
+// maxEmojiSize is the maximum amount of runes of an emoji reaction, enough
+// for modifiers and joined sequences
+const maxEmojiSize = 8
+
+// IsReaction tells whether s is a valid reaction, either a :shortcode: made
+// of lowercase letters, digits, _, + and -, or a short sequence of non-ASCII
+// printable runes such as an emoji
+func IsReaction(s string) bool {
+	if len(s) > 2 && s[0] == ':' && s[len(s)-1] == ':' {
+		name := s[1 : len(s)-1]
+		if len(name) > MaxShortcodeSize {
+			return false
+		}
+		for _, c := range name {
+			switch {
+			case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '+', c == '-':
+			default:
+				return false
+			}
+		}
+		return true
+	}
+
+	if s == "" || !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxEmojiSize {
+		return false
+	}
+	for _, c := range s {
+		if c < utf8.RuneSelf || unicode.IsSpace(c) || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,19 @@
+package network
+
+import "testing"
+
+func TestIsReaction(t *testing.T) {
+	valid := []string{":+1:", ":tada:", ":white_check_mark:", "👍", "👍🏽", "🎉"}
+	invalid := []string{"", "::", ":Tada:", ":a b:", "+1", "ok", "👍 👍", " ", ":" + string(make([]byte, 33)) + ":"}
+
+	for _, s := range valid {
+		if !IsReaction(s) {
+			t.Errorf("%q should be a valid reaction", s)
+		}
+	}
+	for _, s := range invalid {
+		if IsReaction(s) {
+			t.Errorf("%q shouldn't be a valid reaction", s)
+		}
+	}
+}
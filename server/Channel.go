@@ -0,0 +1,234 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// ChannelsPath is the editable path of the file the settings of channels are
+// saved to, they are kept in memory only if it is empty. It holds channel
+// passwords and should only be readable by the server.
+// Default value = channels.json
+var ChannelsPath = "channels.json"
+
+// ChannelTopic is the editable topic of the channel of the server until one is
+// saved to ChannelsPath
+// Default value = ""
+var ChannelTopic = ""
+
+// ChannelModes are the editable modes of the channel of the server until some
+// are saved to ChannelsPath, as given to /mode, ie. +m +l 50
+// Default value = ""
+var ChannelModes = ""
+
+// MOTD is the editable message of the day, sent to the clients joining
+// Default value = ""
+var MOTD = ""
+
+// channel holds the settings of a channel
+type channel struct {
+	Name       string    `json:"name"`
+	Topic      string    `json:"topic,omitempty"`
+	TopicSetBy string    `json:"topic_set_by,omitempty"`
+	TopicSetAt time.Time `json:"topic_set_at,omitempty"`
+
+	// modes of the channel (see Modes.go)
+	InviteOnly bool     `json:"invite_only,omitempty"`
+	Invited    []string `json:"invited,omitempty"`
+	Moderated  bool     `json:"moderated,omitempty"`
+	Voiced     []string `json:"voiced,omitempty"`
+	Password   string   `json:"password,omitempty"`
+	Limit      int      `json:"limit,omitempty"`
+	Secret     bool     `json:"secret,omitempty"`
+}
+
+// channelMap keeps the settings of the channels, saved to a JSON file
+type channelMap struct {
+	sync.Mutex
+	path     string
+	channels map[string]*channel
+}
+
+// loadChannels reads the channels saved to path, which may not exist yet
+func loadChannels(path string) (*channelMap, error) {
+	m := &channelMap{path: path, channels: make(map[string]*channel)}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []*channel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, errors.New("corrupted channels file " + path + " : " + err.Error())
+	}
+	for _, ch := range channels {
+		m.channels[ch.Name] = ch
+	}
+	return m, nil
+}
+
+// setDefault sets the settings of a channel which has none yet, without saving
+// them
+func (m *channelMap) setDefault(ch channel) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.channels[ch.Name]; !ok {
+		m.channels[ch.Name] = &ch
+	}
+}
+
+// defaultChannel returns the settings of the channel of the server given by
+// ChannelTopic and ChannelModes
+func (s *serv) defaultChannel() (channel, error) {
+	ch := channel{Name: s.name}
+	if ChannelTopic != "" {
+		ch.Topic, ch.TopicSetBy, ch.TopicSetAt = ChannelTopic, s.name, time.Now()
+	}
+
+	changes, err := parseModes(strings.Fields(ChannelModes))
+	if err != nil {
+		return ch, err
+	}
+	for _, m := range changes {
+		m.apply(&ch)
+	}
+	return ch, nil
+}
+
+// get returns a copy of the settings of a channel
+func (m *channelMap) get(name string) channel {
+	m.Lock()
+	defer m.Unlock()
+
+	if ch, ok := m.channels[name]; ok {
+		return *ch
+	}
+	return channel{Name: name}
+}
+
+// update changes the settings of a channel with f, and saves them
+func (m *channelMap) update(name string, f func(ch *channel)) (channel, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	ch, ok := m.channels[name]
+	if !ok {
+		ch = &channel{Name: name}
+		m.channels[name] = ch
+	}
+	f(ch)
+	return *ch, m.save()
+}
+
+// save writes the channels to the file of m, the lock being held
+func (m *channelMap) save() error {
+	if m.path == "" {
+		return nil
+	}
+
+	channels := make([]*channel, 0, len(m.channels))
+	for _, ch := range m.channels {
+		channels = append(channels, ch)
+	}
+	return saveJSON(m.path, channels)
+}
+
+// saveJSON writes v to path, only readable by the server
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// replaced at once, so a crash doesn't leave half a file
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// topicPacket builds the packet telling the topic of ch
+// Content : CHANNEL SETTER UNIXTIME [TOPIC]
+func topicPacket(ch channel) (network.Packet, error) {
+	content := ch.Name + " " + ch.TopicSetBy + " " + strconv.FormatInt(ch.TopicSetAt.Unix(), 10)
+	if ch.Topic != "" {
+		content += " " + ch.Topic
+	}
+	return network.UserPacket(network.TopicHead, "", content)
+}
+
+// welcome sends the message of the day and the topic of the channel to a
+// client that just joined
+func (s *serv) welcome(c *server.Client) {
+	if MOTD != "" {
+		s.reply(c, network.SuccessCode, MOTD)
+	}
+
+	ch := s.channels.get(s.name)
+	if ch.Topic == "" {
+		return
+	}
+
+	p, err := topicPacket(ch)
+	if err != nil {
+		s.fail("couldn't send topic", err, clientFields(c))
+		return
+	}
+	s.send(c, p)
+}
+
+// topic shows the topic of the channel, or sets it for operators. A single -
+// clears it.
+//  	/topic [TOPIC]
+func (s *serv) topic(user string, args []string) (string, error) {
+	if len(args) == 0 {
+		ch := s.channels.get(s.name)
+		if ch.Topic == "" {
+			return "no topic is set on " + s.name, nil
+		}
+		return format("topic of %s : %s (set by %s on %s)", s.name, ch.Topic, ch.TopicSetBy, ch.TopicSetAt.Format("2006-01-02 15:04")), nil
+	}
+
+	if c, ok := s.clients.Named(user); !ok || !c.Operator() {
+		return "", errors.New("only operators can set the topic")
+	}
+
+	topic := strings.Join(args, " ")
+	if topic == "-" {
+		topic = ""
+	}
+
+	ch, err := s.channels.update(s.name, func(ch *channel) {
+		ch.Topic, ch.TopicSetBy, ch.TopicSetAt = topic, user, time.Now()
+	})
+	if err != nil {
+		s.fail("couldn't save channels", err, logger.Fields{"channel": s.name})
+	}
+	s.info("topic changed", logger.Fields{"channel": s.name, "name": user, "topic": topic})
+
+	p, err := topicPacket(ch)
+	if err != nil {
+		return "", err
+	}
+	s.sendAll(p)
+	return "", nil
+}
@@ -0,0 +1,504 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// Config holds the settings of a server. They are read from a TOML file, then
+// overridden by GOCHAT_* environment variables and command-line flags.
+//
+type Config struct {
+	Name   string
+	Listen []string
+	Port   int
+	MOTD   string
+
+	ChannelTopic string
+	ChannelModes string
+
+	AllowCompression bool
+
+	MaxPacketSize     int
+	MaxContentSize    int
+	MaxTransferSize   int64
+	MaxHistory        int
+	MaxMentions       int
+	MaxReplay         int
+	DispatchQueueSize int
+
+	HistoryPath  string
+	ChannelsPath string
+	ReadPath     string
+	IndexPath    string
+
+	LogLevel   string
+	LogFormat  string
+	LogFile    string
+	LogMaxSize int64
+	LogBackups int
+
+	MetricsAddress   string
+	WebSocketAddress string
+	WebSocketOrigins []string
+	IRCAddress       string
+
+	TLSCert string
+	TLSKey  string
+
+	PluginSocket string
+
+	IdleMinutes int
+
+	OperatorPassword string
+	Operators        []string
+}
+
+// DefaultConfig returns the settings the server uses when nothing overrides
+// them. No listen address stands for the address returned by Here.
+func DefaultConfig() *Config {
+	return &Config{
+		Name: "ChatRoom",
+		Port: 8081,
+
+		ChannelTopic: ChannelTopic,
+		ChannelModes: ChannelModes,
+
+		AllowCompression: AllowCompression,
+
+		MaxPacketSize:     network.MaxPacketSize,
+		MaxContentSize:    network.MaxContentSize,
+		MaxTransferSize:   MaxTransferSize,
+		MaxHistory:        MaxHistory,
+		MaxMentions:       MaxMentions,
+		MaxReplay:         MaxReplay,
+		DispatchQueueSize: DispatchQueueSize,
+
+		HistoryPath:  HistoryPath,
+		ChannelsPath: ChannelsPath,
+		ReadPath:     ReadPath,
+		IndexPath:    IndexPath,
+
+		LogLevel:   "info",
+		LogFormat:  "text",
+		LogMaxSize: 10 << 20,
+		LogBackups: 5,
+
+		MetricsAddress:   MetricsAddress,
+		WebSocketAddress: WebSocketAddress,
+		WebSocketOrigins: WebSocketOrigins,
+		IRCAddress:       IRCAddress,
+
+		TLSCert: TLSCert,
+		TLSKey:  TLSKey,
+
+		PluginSocket: PluginSocket,
+
+		IdleMinutes: int(IdleAfter / time.Minute),
+
+		OperatorPassword: OperatorPassword,
+		Operators:        Operators,
+	}
+}
+
+// setting binds a configuration key to a field of a Config
+type setting struct {
+	key   string
+	usage string
+	ptr   interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.name", "name of the server", &c.Name},
+		{"server.listen", "comma separated addresses to listen at, HOST[:PORT] or unix:PATH", &c.Listen},
+		{"server.port", "port of the listen addresses that have none", &c.Port},
+		{"server.motd", "message of the day sent to the users joining", &c.MOTD},
+		{"channel.topic", "topic of the channel until one is set with /topic", &c.ChannelTopic},
+		{"channel.modes", "modes of the channel until some are set with /mode, ie. +m +l 50", &c.ChannelModes},
+		{"server.compression", "compress packets for clients supporting it", &c.AllowCompression},
+		{"limits.max_packet_size", "maximum size of a packet, larger ones are fragmented", &c.MaxPacketSize},
+		{"limits.max_content_size", "maximum size of a packet content", &c.MaxContentSize},
+		{"limits.max_transfer_size", "maximum size of a file transfer", &c.MaxTransferSize},
+		{"limits.max_history", "amount of messages kept in memory", &c.MaxHistory},
+		{"limits.max_mentions", "amount of unread mentions kept per user", &c.MaxMentions},
+		{"limits.max_replay", "amount of unread messages replayed to the users coming back", &c.MaxReplay},
+		{"limits.dispatch_queue", "amount of packets waiting to be dispatched", &c.DispatchQueueSize},
+		{"storage.history", "history file, history is kept in memory only if empty", &c.HistoryPath},
+		{"storage.channels", "file channel topics are saved to, kept in memory only if empty", &c.ChannelsPath},
+		{"storage.read", "file the read markers of users are saved to, kept in memory only if empty", &c.ReadPath},
+		{"storage.index", "search index of the history, kept in memory only if empty", &c.IndexPath},
+		{"log.level", "minimum level of log entries (debug, info, warn, error)", &c.LogLevel},
+		{"log.format", "format of log entries (text, logfmt, json)", &c.LogFormat},
+		{"log.file", "log file, standard output if empty", &c.LogFile},
+		{"log.max_size", "size past which the log file is rotated", &c.LogMaxSize},
+		{"log.backups", "amount of rotated log files kept", &c.LogBackups},
+		{"metrics.address", "local address of the metrics endpoint, disabled if empty", &c.MetricsAddress},
+		{"websocket.address", "address of the WebSocket gateway and its chat page, disabled if empty", &c.WebSocketAddress},
+		{"websocket.origins", "origins of the other pages allowed to use the WebSocket gateway", &c.WebSocketOrigins},
+		{"irc.address", "address of the IRC bridge, disabled if empty", &c.IRCAddress},
+		{"tls.cert", "PEM certificate of the WebSocket gateway and the IRC bridge, plain text if empty", &c.TLSCert},
+		{"tls.key", "PEM private key of tls.cert", &c.TLSKey},
+		{"presence.idle_minutes", "inactivity after which users become idle, never if 0", &c.IdleMinutes},
+		{"plugins.socket", "Unix socket out-of-process plugins connect to, disabled if empty", &c.PluginSocket},
+		{"operators.password", "password of /oper, disabled if empty", &c.OperatorPassword},
+		{"operators.users", "comma separated logins of the Unix socket users who are operators", &c.Operators},
+	}
+}
+
+// flag returns the command-line flag of the setting, ie. -log-max-size
+func (s setting) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// env returns the environment variable of the setting, ie. GOCHAT_LOG_MAX_SIZE
+func (s setting) env() string {
+	return "GOCHAT_" + strings.ToUpper(strings.Replace(s.key, ".", "_", -1))
+}
+
+func (s setting) String() string {
+	switch p := s.ptr.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *int64:
+		return strconv.FormatInt(*p, 10)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *[]string:
+		return strings.Join(*p, ",")
+	}
+	return ""
+}
+
+func (s setting) Set(v string) error {
+	var err error
+	switch p := s.ptr.(type) {
+	case *string:
+		*p = v
+	case *int:
+		*p, err = strconv.Atoi(v)
+	case *int64:
+		*p, err = strconv.ParseInt(v, 10, 64)
+	case *bool:
+		*p, err = strconv.ParseBool(v)
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	}
+
+	if err != nil {
+		return errors.New(s.key + " : invalid value " + strconv.Quote(v))
+	}
+	return nil
+}
+
+// IsBoolFlag allows boolean flags to be given without value
+func (s setting) IsBoolFlag() bool {
+	_, ok := s.ptr.(*bool)
+	return ok
+}
+
+// Load reads settings from a TOML file
+func (c *Config) Load(r io.Reader) error {
+	values, err := parseTOML(r)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]setting)
+	for _, s := range c.settings() {
+		known[s.key] = s
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s, ok := known[k]
+		if !ok {
+			return errors.New("unknown setting " + k)
+		}
+		if err := s.Set(values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile reads settings from the TOML file at path
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := c.Load(f); err != nil {
+		return errors.New(path + " : " + err.Error())
+	}
+	return nil
+}
+
+// LoadEnv reads settings from GOCHAT_* environment variables
+func (c *Config) LoadEnv() error {
+	for _, s := range c.settings() {
+		if v, ok := os.LookupEnv(s.env()); ok {
+			if err := s.Set(v); err != nil {
+				return errors.New(s.env() + " : " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// FlagSet returns a flag set overriding the settings of c
+func (c *Config) FlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	for _, s := range c.settings() {
+		fs.Var(s, s.flag(), s.usage+" ($"+s.env()+")")
+	}
+	return fs
+}
+
+// LoadConfig reads the settings of the TOML file at path, unless it is empty,
+// overridden by environment variables
+func LoadConfig(path string) (*Config, error) {
+	c := DefaultConfig()
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseConfig builds the Config of a server from its command-line arguments.
+// The configuration file is given by -config or $GOCHAT_CONFIG, its settings
+// are overridden by environment variables, themselves overridden by flags.
+// The path of the configuration file is returned along with the Config.
+func ParseConfig(name string, args []string) (*Config, string, error) {
+	// first pass only looks for the configuration file
+	fs := DefaultConfig().FlagSet(name)
+	path := fs.String("config", os.Getenv("GOCHAT_CONFIG"), "TOML configuration file ($GOCHAT_CONFIG)")
+	fs.Parse(args)
+
+	c, err := LoadConfig(*path)
+	if err != nil {
+		return nil, *path, err
+	}
+
+	fs = c.FlagSet(name)
+	fs.String("config", *path, "TOML configuration file ($GOCHAT_CONFIG)")
+	fs.Parse(args)
+
+	return c, *path, c.Validate()
+}
+
+// Validate checks every setting, reporting all the invalid ones at once
+func (c *Config) Validate() error {
+	var problems []string
+	invalid := func(key, msg string) {
+		problems = append(problems, key+" "+msg)
+	}
+
+	if c.Name == "" || strings.ContainsAny(c.Name, " \t\r\n") {
+		invalid("server.name", "must be a non-empty word")
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535")
+	}
+
+	for _, addr := range c.Listen {
+		if _, err := parseListenAddr(addr, c.Port); err != nil {
+			invalid("server.listen", "has "+err.Error())
+		}
+	}
+
+	if strings.ContainsAny(c.ChannelTopic, "\r\n") {
+		invalid("channel.topic", "must be a single line")
+	}
+
+	if _, err := parseModes(strings.Fields(c.ChannelModes)); err != nil {
+		invalid("channel.modes", "has "+err.Error())
+	}
+
+	if c.MaxPacketSize < 128 {
+		invalid("limits.max_packet_size", "must be at least 128 bytes")
+	}
+
+	if c.MaxContentSize < 1 {
+		invalid("limits.max_content_size", "must be positive")
+	}
+
+	if c.MaxTransferSize < 0 {
+		invalid("limits.max_transfer_size", "must not be negative")
+	}
+
+	if c.MaxHistory < 1 {
+		invalid("limits.max_history", "must be positive")
+	}
+
+	if c.MaxMentions < 0 {
+		invalid("limits.max_mentions", "must not be negative")
+	}
+
+	if c.MaxReplay < 0 {
+		invalid("limits.max_replay", "must not be negative")
+	}
+
+	if c.DispatchQueueSize < 0 {
+		invalid("limits.dispatch_queue", "must not be negative")
+	}
+
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		invalid("log.level", "must be one of debug, info, warn or error")
+	}
+
+	if _, err := logger.ParseFormat(c.LogFormat); err != nil {
+		invalid("log.format", "must be one of text, logfmt or json")
+	}
+
+	if c.IdleMinutes < 0 {
+		invalid("presence.idle_minutes", "must not be negative")
+	}
+
+	if c.LogMaxSize < 0 {
+		invalid("log.max_size", "must not be negative")
+	}
+
+	if c.LogBackups < 0 {
+		invalid("log.backups", "must not be negative")
+	}
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			invalid("metrics.address", "must be a host:port address")
+		}
+	}
+
+	if c.WebSocketAddress != "" {
+		if _, _, err := net.SplitHostPort(c.WebSocketAddress); err != nil {
+			invalid("websocket.address", "must be a host:port address")
+		}
+	}
+
+	if c.IRCAddress != "" {
+		if _, _, err := net.SplitHostPort(c.IRCAddress); err != nil {
+			invalid("irc.address", "must be a host:port address")
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		invalid("tls.cert", "and tls.key must be set together")
+	} else if _, err := tlsConfig(c.TLSCert, c.TLSKey); err != nil {
+		invalid("tls.cert", "and tls.key can't be loaded : "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration :\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// apply sets the package-wide settings of c
+func (c *Config) apply() {
+	AllowCompression = c.AllowCompression
+	network.MaxPacketSize = c.MaxPacketSize
+	network.MaxContentSize = c.MaxContentSize
+	MaxTransferSize = c.MaxTransferSize
+	MaxHistory = c.MaxHistory
+	MaxMentions = c.MaxMentions
+	MaxReplay = c.MaxReplay
+	DispatchQueueSize = c.DispatchQueueSize
+	HistoryPath = c.HistoryPath
+	ChannelsPath = c.ChannelsPath
+	ReadPath = c.ReadPath
+	IndexPath = c.IndexPath
+	MOTD = c.MOTD
+	ChannelTopic = c.ChannelTopic
+	ChannelModes = c.ChannelModes
+	MetricsAddress = c.MetricsAddress
+	WebSocketAddress = c.WebSocketAddress
+	WebSocketOrigins = c.WebSocketOrigins
+	IRCAddress = c.IRCAddress
+	TLSCert = c.TLSCert
+	TLSKey = c.TLSKey
+	PluginSocket = c.PluginSocket
+	IdleAfter = time.Duration(c.IdleMinutes) * time.Minute
+	OperatorPassword = c.OperatorPassword
+	Operators = c.Operators
+}
+
+// logger creates the Logger described by c, along with its log file if any
+func (c *Config) logger() (logger.Logger, io.Closer, error) {
+	level, err := logger.ParseLevel(c.LogLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format, err := logger.ParseFormat(c.LogFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.LogFile == "" {
+		return logger.New(os.Stdout, format, level), nil, nil
+	}
+
+	f, err := logger.NewRotatingFile(c.LogFile, c.LogMaxSize, c.LogBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logger.New(f, format, level), f, nil
+}
+
+// NewServerConfig creates a new instance of a Server configured by c
+func NewServerConfig(c *Config) (Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	l, f, err := c.logger()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := c.Listen
+	if len(addrs) == 0 {
+		addrs = []string{Here()}
+	}
+
+	c.apply()
+	s, err := newServer(c.Name, addrs, c.Port)
+	if err != nil {
+		return nil, err
+	}
+	s.SetLogger(l)
+	s.config = c
+	s.logFile = f
+	return s, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSampleConfig(t *testing.T) {
+	c := DefaultConfig()
+	if err := c.LoadFile("../gochat.toml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	if c.MaxTransferSize != 16<<20 || c.Name != "ChatRoom" || !c.AllowCompression {
+		t.Errorf("unexpected settings %+v", c)
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	f, err := ioutil.TempFile("", "gochat-*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[server]\nname = 'Lobby' # comment\nport = 9000\n[log]\nlevel = \"debug\"\n")
+	f.Close()
+
+	os.Setenv("GOCHAT_SERVER_PORT", "9001")
+	defer os.Unsetenv("GOCHAT_SERVER_PORT")
+
+	c, _, err := ParseConfig("test", []string{"-config", f.Name(), "-log-level", "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Lobby" || c.Port != 9001 || c.LogLevel != "warn" {
+		t.Errorf("file < env < flags precedence not respected : %+v", c)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	c := DefaultConfig()
+	err := c.Load(strings.NewReader("[server]\nport = 0\n[log]\nformat = \"xml\"\n[channel]\nmodes = \"+l\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.port") || !strings.Contains(err.Error(), "log.format") || !strings.Contains(err.Error(), "channel.modes") {
+		t.Errorf("expected server.port, log.format and channel.modes to be reported, got %v", err)
+	}
+
+	if err := c.Load(strings.NewReader("[server]\nnmae = \"typo\"\n")); err == nil {
+		t.Error("unknown settings should be rejected")
+	}
+}
+
+func TestTLSValidation(t *testing.T) {
+	c := DefaultConfig()
+	c.TLSCert = "cert.pem"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "tls.cert") {
+		t.Errorf("expected tls.cert to be reported without tls.key, got %v", err)
+	}
+
+	c.TLSKey = "key.pem"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "can't be loaded") {
+		t.Errorf("expected missing certificate files to be reported, got %v", err)
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	c, next := DefaultConfig(), DefaultConfig()
+	next.LogLevel = "debug"
+	next.MaxHistory = 10
+	next.Port = 9000
+
+	live, restart := c.diff(next)
+	if strings.Join(live, ",") != "limits.max_history,log.level" {
+		t.Errorf("unexpected live settings %v", live)
+	}
+	if strings.Join(restart, ",") != "server.port" {
+		t.Errorf("unexpected restart settings %v", restart)
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		in, network, address string
+	}{
+		{"", "tcp", ":8081"},
+		{"0.0.0.0", "tcp", "0.0.0.0:8081"},
+		{"127.0.0.1:9000", "tcp", "127.0.0.1:9000"},
+		{"::1", "tcp", "[::1]:8081"},
+		{"[::]", "tcp", "[::]:8081"},
+		{"[::1]:9000", "tcp", "[::1]:9000"},
+		{"localhost", "tcp", "localhost:8081"},
+		{"unix:/tmp/gochat.sock", "unix", "/tmp/gochat.sock"},
+	}
+
+	for _, test := range tests {
+		a, err := parseListenAddr(test.in, 8081)
+		if err != nil {
+			t.Errorf("%q : %v", test.in, err)
+			continue
+		}
+		if a.network != test.network || a.address != test.address {
+			t.Errorf("%q : got %s %s, expected %s %s", test.in, a.network, a.address, test.network, test.address)
+		}
+	}
+
+	for _, in := range []string{"unix:", "host:port", "[::1", "127.0.0.1:70000"} {
+		if _, err := parseListenAddr(in, 8081); err == nil {
+			t.Errorf("%q should be rejected", in)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// console reads administration commands from r, one per line, until r is
+// closed. Answers are written to w.
+func (s *serv) console(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		switch cmd := strings.TrimSpace(scanner.Text()); cmd {
+		case "":
+			continue
+		case "reload":
+			if err := s.Reload(); err != nil {
+				io.WriteString(w, "reload failed : "+err.Error()+"\n")
+			} else {
+				io.WriteString(w, "configuration reloaded\n")
+			}
+		case "help":
+			io.WriteString(w, "commands :\n  reload  read the configuration again\n  help    show this help\n")
+		default:
+			io.WriteString(w, "unknown command "+cmd+", type help for the list of commands\n")
+		}
+	}
+}
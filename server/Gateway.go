@@ -0,0 +1,389 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+	"github.com/Spriithy/gochat-term/server/websocket"
+)
+
+// WebSocketAddress is the editable address of the WebSocket gateway. It
+// serves a chat page at / and carries packets at /ws, one per message. It is
+// disabled if empty.
+// Default value = ""
+var WebSocketAddress = ""
+
+// WebSocketOrigins are the editable origins of the pages allowed to use the
+// WebSocket gateway besides its own, ie. https://chat.example.com
+// Default value = []
+var WebSocketOrigins []string
+
+// serveWebSocket runs the WebSocket gateway on WebSocketAddress
+func (s *serv) serveWebSocket() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, chatPage)
+	})
+	mux.HandleFunc("/ws", s.websocket)
+
+	l, err := listenGateway(WebSocketAddress)
+	if err != nil {
+		s.fail("couldn't start websocket gateway", err, logger.Fields{"address": WebSocketAddress})
+		return
+	}
+
+	s.info("websocket gateway started", logger.Fields{"address": WebSocketAddress, "tls": TLSCert != ""})
+	if err := http.Serve(l, mux); err != nil {
+		s.fail("websocket gateway stopped", err, logger.Fields{"address": WebSocketAddress})
+	}
+}
+
+// websocket reads the packets of a WebSocket client until it disconnects.
+// Once joined, the client may only send packets on its own behalf.
+func (s *serv) websocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, WebSocketOrigins...)
+	if err != nil {
+		s.warn("websocket handshake failed", logger.Fields{"ip": r.RemoteAddr, "error": err})
+		return
+	}
+	defer conn.Close()
+	conn.Limit = network.MaxContentSize + network.MaxPacketSize
+
+	var c *server.Client
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		s.metrics.read(len(data))
+
+		p, err := network.Parse(data)
+		if err != nil {
+			s.warn("dropped packet", logger.Fields{"ip": r.RemoteAddr, "error": err})
+			continue
+		}
+		s.metrics.received(p.Header())
+
+		switch {
+		case p.Header() == network.JoinHead && c == nil:
+			// Content : NAME [CAPABILITIES...]
+			fields := strings.Split(p.Content(), " ")
+			c = server.NewStreamClient(uuid.NextUUID(), fields[0], "websocket", r.RemoteAddr, conn)
+			if !s.register(c, fields[1:]) {
+				// the reason was sent, the page may try again
+				c.Close()
+				c = nil
+			}
+		case c != nil && strings.HasPrefix(p.Content(), string(c.ID())):
+			s.pks <- p
+		default:
+			s.warn("dropped packet", logger.Fields{"ip": r.RemoteAddr, "head": string(p.Header())})
+		}
+	}
+
+	if c != nil {
+		s.disconnect(c.ID(), "connection closed")
+	}
+}
+
+// chatPage is the chat served by the WebSocket gateway. It builds and parses
+// packets itself, see network/Packet.go for their format.
+const chatPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gochat</title>
+<style>
+body { font-family: monospace; margin: 0; display: flex; flex-direction: column; height: 100vh; }
+#log { flex: 1; overflow-y: auto; padding: 1em; white-space: pre-wrap; }
+#topic { padding: 0.5em 1em; border-bottom: 1px solid #888; }
+#topic:empty { display: none; }
+#typing, #seen { height: 1.2em; padding: 0 1em; color: #888; }
+#input { border: none; border-top: 1px solid #888; padding: 1em; font: inherit; }
+.reactions { color: #888; padding-left: 11ch; }
+.mention { background: #ffd; font-weight: bold; }
+.divider { color: #c00; text-align: center; }
+.server { color: #a0a; } .whisper { color: #080; } .error { color: #c00; }
+</style>
+</head>
+<body>
+<div id="topic"></div>
+<div id="log"></div>
+<div id="seen"></div>
+<div id="typing"></div>
+<input id="input" placeholder="message, /w user message, /edit message, /delete or /react :+1:" autofocus>
+<script>
+var log = document.getElementById("log");
+var input = document.getElementById("input");
+var id = "";
+
+// typing are the users typing, with the timers forgetting them
+var typing = {};
+var lastTyping = 0;
+
+function showTyping() {
+	var names = Object.keys(typing).sort();
+	document.getElementById("typing").textContent =
+		names.length === 0 ? "" : names.join(", ") + (names.length === 1 ? " is" : " are") + " typing...";
+}
+
+function setTyping(label, on) {
+	clearTimeout(typing[label]);
+	delete typing[label];
+	if (on) {
+		typing[label] = setTimeout(function () { setTyping(label, false); }, 6000);
+	}
+	showTyping();
+}
+
+function show(text, kind, at) {
+	var line = document.createElement("div");
+	line.className = kind || "";
+	var now = at || new Date();
+	line.textContent = "[" + now.toTimeString().slice(0, 8) + "] " + text;
+	log.appendChild(line);
+	log.scrollTop = log.scrollHeight;
+	return line;
+}
+
+// messages are the lines of the channel messages by id, own is the id of our
+// last message and last the id of the last one
+var messages = {};
+var own = "";
+var last = "";
+
+// readers are the last message read by the others, read is the last one we
+// read and sent as our read marker
+var readers = {};
+var read = "";
+var readTimer = null;
+
+function showSeen() {
+	var names = Object.keys(readers).filter(function (n) { return own !== "" && readers[n] >= own; }).sort();
+	document.getElementById("seen").textContent = names.length === 0 ? "" : "seen by " + names.join(", ");
+}
+
+// markRead sends our read marker once the page is shown, at most every 2
+// seconds
+function markRead() {
+	if (document.hidden || last <= read || readTimer !== null) {
+		return;
+	}
+	readTimer = setTimeout(function () {
+		readTimer = null;
+		read = last;
+		ws.send(packet("V", id + " " + read));
+	}, 2000);
+}
+document.onvisibilitychange = markRead;
+
+// user packets : HEAD ' ' MM SS ' ' CONTENT \r\n
+function packet(head, content) {
+	var now = new Date();
+	return head + " " + String.fromCharCode(now.getMinutes(), now.getSeconds()) + " " + content + "\r\n";
+}
+
+var name = prompt("Enter username:") || "";
+name = name.split(/\s+/)[0];
+var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+ws.binaryType = "arraybuffer";
+ws.onopen = function () { ws.send(packet("J", name)); };
+ws.onclose = function () { show("disconnected", "error"); };
+ws.onmessage = function (e) {
+	var data = new TextDecoder().decode(e.data);
+	var head = data[0];
+	if (head === "S") {
+		// server packets : S ' ' CODE ' ' MM SS ' ' CONTENT \r\n
+		var text = data.slice(7, -2);
+		show(text, data[2] === "0" ? "server" : "error");
+		if (id === "" && data[2] === "1" && text.indexOf("password") >= 0) {
+			var key = prompt("Password of the channel:");
+			if (key) {
+				ws.send(packet("J", name + " key=" + key.split(/\s+/)[0]));
+			}
+		}
+		return;
+	}
+
+	var content = data.slice(5, -2);
+	var space = content.indexOf(" ");
+	var first = space < 0 ? content : content.slice(0, space);
+	var rest = space < 0 ? "" : content.slice(space + 1);
+	switch (head) {
+	case "J":
+		id = first;
+		show("joined as " + name, "server");
+		break;
+	case "M":
+	case "R":
+	case "E":
+	case "D":
+		// Content : MSGID NAME [PARENT] [MESSAGE]
+		var space2 = rest.indexOf(" ");
+		var from = space2 < 0 ? rest : rest.slice(0, space2);
+		var text = space2 < 0 ? "" : rest.slice(space2 + 1);
+		if (head === "M" || head === "R") {
+			setTyping(from, false);
+			var quote = "";
+			if (head === "R") {
+				var space3 = text.indexOf(" ");
+				var parent = messages[text.slice(0, space3)];
+				text = text.slice(space3 + 1);
+				quote = parent ? "> " + parent.textContent.slice(11, 51) + "\n  " : "> (older message)\n  ";
+			}
+			var mentioned = new RegExp("(^|\\s)@" + name + "(\\W|$)").test(text);
+			// ids are hexadecimal nanoseconds, replayed messages keep their time
+			var at = new Date(parseInt(first, 16) / 1e6);
+			messages[first] = show("<" + from + "> " + quote + text, mentioned ? "mention" : "", at);
+			last = first > last ? first : last;
+			if (from === name) {
+				own = first;
+				showSeen();
+			}
+			markRead();
+		} else if (messages[first]) {
+			var line = messages[first];
+			var time = line.textContent.slice(0, 11);
+			if (head === "E") {
+				line.textContent = time + line.textContent.slice(11).match(/^<\S+> /)[0] + text + " (edited)";
+			} else {
+				line.textContent = time + "(message deleted by " + from + ")";
+				line.className = "server";
+				if (line.summary) {
+					log.removeChild(line.summary);
+				}
+				delete messages[first];
+			}
+		}
+		break;
+	case "U":
+		// Content : MSGID REACTION [NAMES...]
+		var line = messages[first];
+		if (!line) {
+			break;
+		}
+		var users = rest.split(" ");
+		var reaction = users.shift();
+		if (!line.reactions) {
+			line.reactions = {};
+			line.summary = document.createElement("div");
+			line.summary.className = "reactions";
+			log.insertBefore(line.summary, line.nextSibling);
+		}
+		if (users.length === 0) {
+			delete line.reactions[reaction];
+		} else {
+			line.reactions[reaction] = users;
+		}
+		line.summary.textContent = Object.keys(line.reactions).sort().map(function (k) {
+			return k + " " + line.reactions[k].length + " (" + line.reactions[k].join(", ") + ")";
+		}).join("  ");
+		break;
+	case "N":
+		// Content : MSGID FROM CHANNEL MESSAGE, the message may have been shown
+		if (!messages[first]) {
+			var parts = rest.split(" ");
+			messages[first] = show("<" + parts[0] + " in " + parts[1] + "> " + parts.slice(2).join(" "), "mention");
+		}
+		break;
+	case "H":
+		// Content : CHANNEL SETTER UNIXTIME [TOPIC]
+		var topic = content.split(" ").slice(3).join(" ");
+		document.getElementById("topic").textContent = topic;
+		document.title = "[ " + first + " ]" + (topic === "" ? "" : " " + topic);
+		break;
+	case "V":
+		// Content : NAME MSGID [UNREAD], the unread messages are sent on demand
+		var parts = rest.split(" ");
+		if (first === name && parts.length === 2) {
+			var since = new Date(parseInt(parts[0], 16) / 1e6);
+			show("──── " + parts[1] + " unread messages since " + since.toLocaleString() + " ────", "divider");
+			ws.send(packet("V", id));
+		} else if (first !== name) {
+			readers[first] = parts[0];
+			showSeen();
+		}
+		break;
+	case "T":
+		// Content : NAME [whisper]
+		setTyping(rest === "" ? first : "@" + first, true);
+		break;
+	case "W":
+		setTyping("@" + first, false);
+		if (rest.indexOf("e2e ") === 0) {
+			rest = "(encrypted whisper, use the terminal client to read it)";
+		}
+		show("@" + first + " " + rest, "whisper");
+		break;
+	}
+};
+
+// typing is sent at most every 3 seconds, to the channel or the recipient of
+// a whisper
+input.oninput = function () {
+	var now = Date.now();
+	if (id === "" || input.value === "" || now - lastTyping < 3000) {
+		return;
+	}
+	lastTyping = now;
+
+	var whisper = input.value.match(/^\/w(?:hisper)?\s+(\S+)\s/);
+	if (whisper) {
+		ws.send(packet("T", id + " " + whisper[1]));
+	} else if (input.value[0] !== "/") {
+		ws.send(packet("T", id));
+	}
+};
+
+input.onkeydown = function (e) {
+	if (e.key !== "Enter" || input.value === "" || id === "") {
+		return;
+	}
+
+	var text = input.value;
+	input.value = "";
+	lastTyping = 0;
+	var whisper = text.match(/^\/w(?:hisper)?\s+(\S+)\s+(.+)$/);
+	var edit = text.match(/^\/edit\s+(.+)$/);
+	var react = text.match(/^\/react\s+(\S+)$/);
+	if (react) {
+		// react to the last message
+		if (last !== "") {
+			ws.send(packet("U", id + " " + last + " " + react[1]));
+		}
+	} else if (edit || text === "/delete") {
+		// change our last message
+		if (own === "") {
+			show("no message to change", "error");
+		} else if (edit) {
+			ws.send(packet("E", id + " " + own + " " + edit[1]));
+		} else {
+			ws.send(packet("D", id + " " + own));
+		}
+	} else if (whisper) {
+		ws.send(packet("W", id + " " + whisper[1] + " " + whisper[2]));
+		show("@" + whisper[1] + " " + whisper[2], "whisper");
+	} else {
+		ws.send(packet("M", id + " " + text));
+	}
+};
+
+window.onbeforeunload = function () {
+	if (id !== "") {
+		ws.send(packet("L", id));
+	}
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/irc"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// IRCAddress is the editable address of the IRC bridge, letting IRC clients
+// take part in the server's channel. It is disabled if empty.
+// Default value = ""
+var IRCAddress = ""
+
+// ircHost is the host part of the prefixes of the bridge's messages
+const ircHost = "gochat"
+
+// ircConn is the connection of an IRC client. It translates the packets
+// sent to the client into IRC messages.
+type ircConn struct {
+	sync.Mutex
+	conn    net.Conn
+	server  string
+	channel string
+	nick    string
+	id      string
+	joined  bool
+
+	// history quotes the parents of replies
+	history *history.Store
+
+	// read is the last channel message relayed to the client, unread tells
+	// the messages it missed until it joins the channel
+	read   string
+	unread string
+}
+
+func (c *ircConn) isJoined() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.joined
+}
+
+func (c *ircConn) setJoined(joined bool) {
+	c.Lock()
+	c.joined = joined
+	c.Unlock()
+}
+
+func (c *ircConn) lastRead() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.read
+}
+
+func (c *ircConn) setRead(id string) {
+	c.Lock()
+	c.read = id
+	c.Unlock()
+}
+
+// Close closes the connection of the IRC client, which then leaves
+func (c *ircConn) Close() error {
+	return c.conn.Close()
+}
+
+// reply sends an IRC message from the server
+func (c *ircConn) reply(command string, params ...string) {
+	c.send(irc.Message{Prefix: c.server, Command: command, Params: params})
+}
+
+// numeric sends a numeric reply, which first parameter is the nickname
+func (c *ircConn) numeric(code string, params ...string) {
+	nick := c.nick
+	if nick == "" {
+		nick = "*"
+	}
+	c.reply(code, append([]string{nick}, params...)...)
+}
+
+func (c *ircConn) send(m irc.Message) error {
+	c.Lock()
+	defer c.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write([]byte(m.String()))
+	return err
+}
+
+// notice sends a notice from the server, one per line of text
+func (c *ircConn) notice(target, text string) {
+	for _, line := range irc.Lines(text) {
+		c.reply("NOTICE", target, line)
+	}
+}
+
+// from sends an IRC message on behalf of a gochat user, one per line of text
+func (c *ircConn) from(name, command, target, text string) {
+	for _, line := range irc.Lines(text) {
+		c.send(irc.Message{Prefix: name + "!" + name + "@" + ircHost, Command: command, Params: []string{target, line}})
+	}
+}
+
+// Write translates a packet sent by the server to the IRC client
+func (c *ircConn) Write(data []byte) (int, error) {
+	p, err := network.Parse(data)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.SplitN(p.Content(), " ", 2)
+	switch p.Header() {
+	case network.ServerHead:
+		// MOTDs and command answers may span several lines
+		c.notice(c.nick, p.Content())
+	case network.JoinHead:
+		c.numeric(irc.RplWelcome, "Welcome to gochat, "+c.nick)
+	case network.MessageHead:
+		// Content : MSGID NAME MESSAGE
+		m := strings.SplitN(p.Content(), " ", 3)
+		if len(m) != 3 || !c.isJoined() {
+			break
+		}
+		c.setRead(m[0])
+		if m[1] != c.nick {
+			c.from(m[1], "PRIVMSG", c.channel, m[2])
+		}
+	case network.ReplyHead:
+		// Content : MSGID NAME PARENT MESSAGE, the parent is quoted
+		m := strings.SplitN(p.Content(), " ", 4)
+		if len(m) != 4 || !c.isJoined() {
+			break
+		}
+		c.setRead(m[0])
+		if m[1] == c.nick {
+			break
+		}
+		if parent, ok := c.history.Get(m[2]); ok {
+			m[3] = "> " + parent.Name + ": " + history.Excerpt(parent.Content) + "\n" + m[3]
+		}
+		c.from(m[1], "PRIVMSG", c.channel, m[3])
+	case network.ReactionHead:
+		// Content : MSGID REACTION [NAMES...], IRC has no reactions
+		m := strings.Fields(p.Content())
+		if len(m) < 3 || !c.isJoined() {
+			break
+		}
+		text := m[1] + " by " + strings.Join(m[2:], ", ")
+		if parent, ok := c.history.Get(m[0]); ok {
+			text += " on " + parent.Name + ": " + history.Excerpt(parent.Content)
+		}
+		c.reply("NOTICE", c.channel, text)
+	case network.TopicHead:
+		// Content : CHANNEL SETTER UNIXTIME [TOPIC], sent on join as well
+		m := strings.SplitN(p.Content(), " ", 4)
+		if len(m) < 3 || !c.isJoined() {
+			break
+		}
+		topic := ""
+		if len(m) == 4 {
+			topic = m[3]
+		}
+		c.from(m[1], "TOPIC", c.channel, topic)
+	case network.EditHead:
+		// Content : MSGID NAME MESSAGE, IRC has no edits
+		if m := strings.SplitN(p.Content(), " ", 3); len(m) == 3 && c.isJoined() {
+			c.from(m[1], "NOTICE", c.channel, "edited a message : "+m[2])
+		}
+	case network.DeleteHead:
+		// Content : MSGID NAME
+		if m := strings.Fields(p.Content()); len(m) == 2 && c.isJoined() {
+			c.from(m[1], "NOTICE", c.channel, "deleted a message")
+		}
+	case network.ReadHead:
+		// Content : NAME MSGID UNREAD, sent on join. Receipts are ignored.
+		m := strings.Fields(p.Content())
+		if len(m) != 3 || m[0] != c.nick {
+			break
+		}
+		c.Lock()
+		c.unread = m[2] + " unread messages"
+		if t, ok := history.IDTime(m[1]); ok {
+			c.unread += " since " + t.Format("2006-01-02 15:04")
+		}
+		c.Unlock()
+	case network.WhisperHead:
+		// Content : FROM MESSAGE
+		if len(fields) != 2 {
+			break
+		}
+		if network.IsSealed(fields[1]) {
+			c.reply("NOTICE", c.nick, fields[0]+" sent an encrypted whisper, which IRC clients can't read")
+		} else {
+			c.from(fields[0], "PRIVMSG", c.nick, fields[1])
+		}
+	case network.OfferHead:
+		// Content : FROM FILEID SIZE SUM NAME
+		c.reply("NOTICE", c.nick, fields[0]+" offered a file, which IRC clients can't receive")
+	}
+	return len(data), nil
+}
+
+// serveIRC runs the IRC bridge on IRCAddress
+func (s *serv) serveIRC() {
+	l, err := listenGateway(IRCAddress)
+	if err != nil {
+		s.fail("couldn't start irc bridge", err, logger.Fields{"address": IRCAddress})
+		return
+	}
+	defer l.Close()
+
+	s.info("irc bridge started", logger.Fields{"address": IRCAddress, "channel": "#" + s.name, "tls": TLSCert != ""})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.fail("couldn't accept connection", err, nil)
+			continue
+		}
+		go s.irc(conn)
+	}
+}
+
+// irc reads the messages of an IRC client until it quits, mapping them to
+// gochat packets
+func (s *serv) irc(conn net.Conn) {
+	defer conn.Close()
+
+	c := &ircConn{conn: conn, server: ircHost, channel: "#" + s.name, history: s.history}
+	var client *server.Client
+	user := false
+	key := ""
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, irc.MaxLineSize), irc.MaxLineSize)
+	for scanner.Scan() {
+		m, err := irc.Parse(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		if len(m.Params) < ircParams[m.Command] {
+			c.numeric(irc.ErrNeedMoreParam, m.Command, "Not enough parameters")
+			continue
+		}
+
+		switch m.Command {
+		case "CAP":
+			if m.Params[0] == "LS" {
+				c.reply("CAP", "*", "LS", "")
+			}
+		case "PING":
+			c.reply("PONG", c.server, m.Params[0])
+		case "PONG", "MODE", "WHO", "USERHOST":
+			// not needed by the bridge
+		case "NICK":
+			switch {
+			case client != nil:
+				c.reply("NOTICE", c.nick, "nickname changes aren't supported")
+			case !irc.ValidNick(m.Params[0]):
+				c.numeric(irc.ErrErroneusNick, m.Params[0], "Erroneous nickname")
+			default:
+				c.nick = m.Params[0]
+			}
+		case "PASS":
+			// the password of the channel
+			key = m.Params[0]
+		case "USER":
+			user = true
+		case "QUIT":
+			return
+		default:
+			if client == nil {
+				c.numeric(irc.ErrNotRegistered, "You have not registered")
+				continue
+			}
+			s.ircCommand(c, m)
+		}
+
+		if client == nil && user && c.nick != "" {
+			if _, taken := s.clients.Named(c.nick); taken {
+				c.numeric(irc.ErrNicknameInUse, c.nick, "Nickname is already in use")
+				c.nick = ""
+				continue
+			}
+
+			client = server.NewStreamClient(uuid.NextUUID(), c.nick, "irc", conn.RemoteAddr().String(), c)
+			// set before any packet is written to the client
+			c.id = string(client.ID())
+			if !s.register(client, []string{network.KeyCapability + key}) {
+				// the reason was sent as a notice
+				client.Flush()
+				c.reply("ERROR", "Closing link")
+				return
+			}
+		}
+	}
+
+	if client != nil {
+		s.ircRead(c)
+		s.disconnect(client.ID(), "connection closed")
+	}
+}
+
+// ircRead moves the read marker of an IRC client to the last message relayed
+// to it
+func (s *serv) ircRead(c *ircConn) {
+	client, ok := s.clients.Get(uuid.UUID(c.id))
+	if id := c.lastRead(); ok && id != "" {
+		s.markRead(client, id)
+	}
+}
+
+// ircParams are the amount of parameters required by IRC commands
+var ircParams = map[string]int{
+	"CAP": 1, "PASS": 1, "PING": 1, "NICK": 1, "USER": 4, "JOIN": 1, "PART": 1, "PRIVMSG": 2, "NOTICE": 2, "TOPIC": 1,
+}
+
+// ircCommand handles the commands of a registered IRC client
+func (s *serv) ircCommand(c *ircConn, m irc.Message) {
+	switch m.Command {
+	case "JOIN":
+		if !strings.EqualFold(m.Params[0], c.channel) {
+			c.numeric(irc.ErrNoSuchChannel, m.Params[0], "No such channel")
+			return
+		}
+
+		c.setJoined(true)
+		c.send(irc.Message{Prefix: c.nick + "!" + c.nick + "@" + ircHost, Command: "JOIN", Params: []string{c.channel}})
+		s.ircTopic(c)
+
+		var names []string
+		for client := range s.clients.Iter() {
+			names = append(names, client.Name())
+		}
+		visibility := "="
+		if s.channels.get(s.name).Secret {
+			visibility = "@"
+		}
+		c.numeric(irc.RplNamReply, visibility, c.channel, strings.Join(names, " "))
+		c.numeric(irc.RplEndOfNames, c.channel, "End of /NAMES list")
+
+		// the messages missed since the last visit follow
+		c.Lock()
+		unread := c.unread
+		c.unread = ""
+		c.Unlock()
+		if unread != "" {
+			c.reply("NOTICE", c.channel, "-- "+unread+" --")
+			s.ircPacket(network.ReadHead, c.id)
+		}
+	case "TOPIC":
+		if !strings.EqualFold(m.Params[0], c.channel) {
+			c.numeric(irc.ErrNoSuchChannel, m.Params[0], "No such channel")
+			return
+		}
+		if len(m.Params) == 1 {
+			s.ircTopic(c)
+			return
+		}
+		if client, ok := s.clients.Named(c.nick); !ok || !client.Operator() {
+			c.numeric(irc.ErrChanOPrivs, c.channel, "You're not channel operator")
+			return
+		}
+
+		topic := m.Params[1]
+		if topic == "" {
+			topic = "-"
+		}
+		s.ircPacket(network.CommandHead, c.id+" topic "+topic)
+	case "LIST":
+		// secret channels are only listed to their members
+		ch := s.channels.get(s.name)
+		if ch.Secret && !c.isJoined() {
+			c.numeric(irc.RplListEnd, "End of /LIST")
+			return
+		}
+
+		s.ircRead(c)
+		topic := ch.Topic
+		if n := len(s.unread(c.nick, s.reads.get(c.nick, s.name))); n > 0 {
+			topic = strings.TrimSpace(format("[%d unread] %s", n, topic))
+		}
+		c.numeric(irc.RplList, c.channel, strconv.Itoa(s.clients.Size()), topic)
+		c.numeric(irc.RplListEnd, "End of /LIST")
+	case "PART":
+		if c.isJoined() && strings.EqualFold(m.Params[0], c.channel) {
+			s.ircRead(c)
+			c.setJoined(false)
+			c.from(c.nick, "PART", c.channel, "")
+		}
+	case "PRIVMSG", "NOTICE":
+		target, text := m.Params[0], m.Params[1]
+		if strings.EqualFold(target, c.channel) {
+			if !c.isJoined() {
+				c.numeric(irc.ErrNotOnChannel, target, "You're not on that channel")
+				return
+			}
+			s.ircPacket(network.MessageHead, c.id+" "+text)
+			return
+		}
+
+		if _, ok := s.clients.Named(target); !ok {
+			c.numeric(irc.ErrNoSuchNick, target, "No such nick/channel")
+			return
+		}
+		s.ircPacket(network.WhisperHead, c.id+" "+target+" "+text)
+	default:
+		c.numeric(irc.ErrUnknownCmd, m.Command, "Unknown command")
+	}
+}
+
+// ircTopic sends the topic of the channel to an IRC client
+func (s *serv) ircTopic(c *ircConn) {
+	ch := s.channels.get(s.name)
+	if ch.Topic == "" {
+		c.numeric(irc.RplNoTopic, c.channel, "No topic is set")
+		return
+	}
+	c.numeric(irc.RplTopic, c.channel, ch.Topic)
+	c.numeric(irc.RplTopicWhoTime, c.channel, ch.TopicSetBy, strconv.FormatInt(ch.TopicSetAt.Unix(), 10))
+}
+
+// ircPacket dispatches a packet on behalf of an IRC client
+func (s *serv) ircPacket(head byte, content string) {
+	p, err := network.UserPacket(head, "", content)
+	if err != nil {
+		s.warn("dropped irc message", logger.Fields{"error": err})
+		return
+	}
+	s.metrics.received(head)
+	s.pks <- p
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// unixPrefix marks the listen addresses of Unix domain sockets
+const unixPrefix = "unix:"
+
+// listenAddr is an address the server accepts connections at
+type listenAddr struct {
+	network string
+	address string
+}
+
+func (a listenAddr) String() string {
+	if a.network == "unix" {
+		return unixPrefix + a.address
+	}
+	return a.address
+}
+
+// parseListenAddr reads a listen address, either unix:PATH for a Unix domain
+// socket or HOST[:PORT] where an IPv6 HOST may be bracketed. An empty HOST
+// stands for every interface, port is used when the address has none.
+func parseListenAddr(s string, port int) (listenAddr, error) {
+	if strings.HasPrefix(s, unixPrefix) {
+		path := s[len(unixPrefix):]
+		if path == "" {
+			return listenAddr{}, errors.New("missing socket path in " + s)
+		}
+		return listenAddr{"unix", path}, nil
+	}
+
+	host, p, err := net.SplitHostPort(s)
+	if err != nil {
+		// no port, IPv6 addresses may still be bracketed
+		host, p = s, strconv.Itoa(port)
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			host = s[1 : len(s)-1]
+		}
+	}
+
+	if strings.ContainsAny(host, "[]") {
+		return listenAddr{}, errors.New("malformed address " + s)
+	}
+
+	if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+		return listenAddr{}, errors.New("invalid port in " + s)
+	}
+
+	return listenAddr{"tcp", net.JoinHostPort(host, p)}, nil
+}
+
+// listen opens a listener for every address of the server
+func (s *serv) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, a := range s.addrs {
+		if a.network == "unix" {
+			removeStaleSocket(a.address)
+		}
+
+		l, err := net.Listen(a.network, a.address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.New(a.String() + " : " + err.Error())
+		}
+		listeners = append(listeners, l)
+
+		// local users are authenticated by their credentials, access to the
+		// socket is restricted by the permissions of its directory
+		if a.network == "unix" {
+			if err := os.Chmod(a.address, 0666); err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return nil, errors.New(a.String() + " : " + err.Error())
+			}
+		}
+	}
+	return listeners, nil
+}
+
+// unixUser authenticates a client joining through a Unix domain socket. It
+// is known by the login name of the user running it, who must also own the
+// socket the client listens at.
+func unixUser(conn net.Conn, socket string) (string, error) {
+	uid, err := peerUID(conn)
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := socketOwner(socket)
+	if err != nil {
+		return "", err
+	}
+	if owner != uid {
+		return "", errors.New(socket + " isn't owned by the client")
+	}
+
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// removeStaleSocket removes the socket left at path by a previous run. Any
+// other kind of file is kept.
+func removeStaleSocket(path string) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
+
+// accept reads one packet per connection accepted by l
+func (s *serv) accept(l net.Listener) {
+	defer l.Close()
+
+	s.info("listening", logger.Fields{"address": l.Addr().String(), "network": l.Addr().Network()})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.fail("couldn't accept connection", err, nil)
+			continue
+		}
+
+		data := make([]byte, network.MaxPacketSize)
+		n, err := conn.Read(data)
+		if err != nil {
+			s.fail("couldn't read packet", err, packetFields(conn, nil))
+			conn.Close()
+			continue
+		}
+
+		s.metrics.read(n)
+		s.emmit(conn, data[:n])
+		conn.Close()
+	}
+}
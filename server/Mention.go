@@ -0,0 +1,125 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// MaxMentions is the editable amount of unread mentions kept per user, the
+// oldest ones being dropped
+// Default value = 100
+var MaxMentions = 100
+
+// mention is a channel message mentioning a user
+type mention struct {
+	id      string
+	time    time.Time
+	from    string
+	channel string
+	text    string
+}
+
+// mentionMap keeps the unread mentions of every user, by name. They are kept
+// in memory only.
+type mentionMap struct {
+	sync.Mutex
+	unread map[string][]mention
+}
+
+func newMentionMap() *mentionMap {
+	return &mentionMap{unread: make(map[string][]mention)}
+}
+
+func (m *mentionMap) add(name string, mn mention) {
+	m.Lock()
+	defer m.Unlock()
+
+	list := append(m.unread[name], mn)
+	if len(list) > MaxMentions {
+		list = list[len(list)-MaxMentions:]
+	}
+	m.unread[name] = list
+}
+
+func (m *mentionMap) count(name string) int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.unread[name])
+}
+
+// take returns the unread mentions of name, which are then read
+func (m *mentionMap) take(name string) []mention {
+	m.Lock()
+	defer m.Unlock()
+
+	list := m.unread[name]
+	delete(m.unread, name)
+	return list
+}
+
+// known tells whether name is connected or wrote one of the messages in
+// memory, so mentions of random words aren't kept
+func (s *serv) known(name string) bool {
+	if _, ok := s.clients.Named(name); ok {
+		return true
+	}
+
+	for _, r := range s.history.Range("", time.Time{}, time.Time{}) {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyMentions records the mentions of a channel message, and notifies the
+// mentioned users who are connected whatever their status
+func (s *serv) notifyMentions(id, from, text string) {
+	for _, name := range network.Mentions(text) {
+		if name == from || !s.known(name) {
+			continue
+		}
+
+		s.mentions.add(name, mention{id, time.Now(), from, s.name, text})
+
+		c, ok := s.clients.Named(name)
+		if !ok {
+			continue
+		}
+
+		p, err := network.UserPacket(network.MentionHead, "", id+" "+from+" "+s.name+" "+text)
+		if err != nil {
+			s.fail("couldn't notify mention", err, logger.Fields{"name": name, "message": id})
+			continue
+		}
+		s.send(c, p)
+	}
+}
+
+// unreadMentions tells a client joining how many times it was mentioned
+func (s *serv) unreadMentions(c *server.Client) {
+	if n := s.mentions.count(c.Name()); n > 0 {
+		s.reply(c, network.SuccessCode, format("you were mentioned %d times, /mentions to read them", n))
+	}
+}
+
+// listMentions lists the unread mentions of user, which are then read
+//  	/mentions
+func (s *serv) listMentions(user string, args []string) (string, error) {
+	list := s.mentions.take(user)
+	if len(list) == 0 {
+		return "no unread mentions", nil
+	}
+
+	lines := make([]string, len(list))
+	for i, m := range list {
+		lines[i] = format("[%s] #%s <%s in %s> %s", m.time.Format("2006-01-02 15:04"), m.id[len(m.id)-4:], m.from, m.channel, history.Excerpt(m.text))
+	}
+	return format("%d unread mentions :\n  %s", len(list), strings.Join(lines, "\n  ")), nil
+}
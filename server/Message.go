@@ -0,0 +1,233 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+	"github.com/Spriithy/gochat-term/server/plugin"
+)
+
+// HistoryPath is the editable path of the file channel messages are appended
+// to, history is only kept in memory if it is empty
+// Default value = history.jsonl
+var HistoryPath = "history.jsonl"
+
+// MaxHistory is the editable amount of messages kept in memory
+// Default value = 1000
+var MaxHistory = 1000
+
+// message broadcasts a channel message once the plugins let it through
+// Content : ID MESSAGE
+func (s *serv) message(p network.Packet) {
+	from, fields, ok := s.sender(p, 2)
+	if !ok {
+		return
+	}
+	s.post(from, "", fields[0])
+}
+
+// replyMessage broadcasts a reply to a channel message once the plugins let
+// it through
+// Content : ID PARENT MESSAGE
+func (s *serv) replyMessage(p network.Packet) {
+	from, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	parent := fields[0]
+	if r, ok := s.history.Get(parent); !ok || r.Head != string(network.MessageHead) {
+		s.reply(from, network.RequestErrorCode, "no message "+parent)
+		return
+	}
+	s.post(from, parent, fields[1])
+}
+
+// post broadcasts a message of from, replying to parent unless it is empty,
+// once the plugins let it through
+func (s *serv) post(from *server.Client, parent, text string) {
+	if !s.mayTalk(from) {
+		return
+	}
+
+	m := &plugin.Message{From: from.Name(), Channel: s.name, Text: text}
+	if !s.hooks.Message(m) {
+		s.reply(from, network.PermissionErrorCode, "message was rejected")
+		return
+	}
+	s.broadcast(m.From, parent, m.Text)
+}
+
+// broadcast sends a channel message from name to every client and records it
+// in the history. Replies are relayed with the id of their parent.
+func (s *serv) broadcast(name, parent, text string) {
+	rec := history.Record{
+		ID:      history.NewID(),
+		Time:    time.Now(),
+		Channel: s.name,
+		Head:    string(network.MessageHead),
+		Name:    name,
+		Content: text,
+		Parent:  parent}
+
+	r, err := messagePacket(rec)
+	if err != nil {
+		s.fail("couldn't relay message", err, logger.Fields{"name": name})
+		return
+	}
+
+	if err = s.history.Append(rec); err != nil {
+		s.fail("couldn't record message", err, logger.Fields{"name": name, "channel": s.name})
+	}
+	if err = s.index.Add(rec); err != nil {
+		s.fail("couldn't index message", err, logger.Fields{"name": name, "channel": s.name})
+	}
+
+	s.sendAll(r)
+	s.notifyMentions(rec.ID, name, text)
+}
+
+// messagePacket builds the packet relaying a channel message
+func messagePacket(r history.Record) (network.Packet, error) {
+	if r.Parent != "" {
+		return network.UserPacket(network.ReplyHead, "", r.ID+" "+r.Name+" "+r.Parent+" "+r.Content)
+	}
+	return network.UserPacket(network.MessageHead, "", r.ID+" "+r.Name+" "+r.Content)
+}
+
+// changed returns the message c wants to change, once c is allowed to : authors
+// change their messages, operators any message
+func (s *serv) changed(c *server.Client, id string) (history.Record, bool) {
+	r, ok := s.history.Get(id)
+	if !ok || r.Head != string(network.MessageHead) {
+		s.reply(c, network.RequestErrorCode, "no message "+id)
+		return r, false
+	}
+
+	if r.Name != c.Name() && !c.Operator() {
+		s.reply(c, network.PermissionErrorCode, "you can only change your own messages")
+		return r, false
+	}
+	return r, true
+}
+
+// edit replaces the text of a channel message once the plugins let it through
+// Content : ID MSGID MESSAGE
+func (s *serv) edit(p network.Packet) {
+	c, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	id := fields[0]
+	if _, ok := s.changed(c, id); !ok || !s.mayTalk(c) {
+		return
+	}
+
+	m := &plugin.Message{From: c.Name(), Channel: s.name, Text: fields[1]}
+	if !s.hooks.Message(m) {
+		s.reply(c, network.PermissionErrorCode, "message was rejected")
+		return
+	}
+
+	if err := s.history.Edit(id, c.Name(), m.Text); err != nil {
+		s.fail("couldn't record edit", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+	if edited, ok := s.history.Get(id); ok {
+		if err := s.index.Add(edited); err != nil {
+			s.fail("couldn't index edit", err, logger.Fields{"name": c.Name(), "message": id})
+		}
+	}
+
+	r, err := network.UserPacket(network.EditHead, "", id+" "+c.Name()+" "+m.Text)
+	if err != nil {
+		s.fail("couldn't relay edit", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+	s.sendAll(r)
+}
+
+// delete removes a channel message
+// Content : ID MSGID
+func (s *serv) delete(p network.Packet) {
+	c, fields, ok := s.sender(p, 2)
+	if !ok {
+		return
+	}
+
+	id := fields[0]
+	if _, ok := s.changed(c, id); !ok {
+		return
+	}
+
+	if err := s.history.Delete(id, c.Name()); err != nil {
+		s.fail("couldn't record deletion", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+	s.info("message deleted", logger.Fields{"name": c.Name(), "message": id})
+	if err := s.index.Remove(id); err != nil {
+		s.fail("couldn't unindex deletion", err, logger.Fields{"name": c.Name(), "message": id})
+	}
+
+	r, err := network.UserPacket(network.DeleteHead, "", id+" "+c.Name())
+	if err != nil {
+		s.fail("couldn't relay deletion", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+	s.sendAll(r)
+}
+
+// react toggles the reaction of a client to a channel message, and relays
+// every user who reacted the same way
+// Content : ID MSGID REACTION
+func (s *serv) react(p network.Packet) {
+	c, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	id, reaction := fields[0], fields[1]
+	if !network.IsReaction(reaction) {
+		s.reply(c, network.RequestErrorCode, "invalid reaction "+reaction)
+		return
+	}
+
+	if r, ok := s.history.Get(id); !ok || r.Head != string(network.MessageHead) {
+		s.reply(c, network.RequestErrorCode, "no message "+id)
+		return
+	}
+
+	names, err := s.history.React(id, c.Name(), reaction)
+	if err != nil {
+		s.fail("couldn't record reaction", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+
+	content := id + " " + reaction
+	if len(names) > 0 {
+		content += " " + strings.Join(names, " ")
+	}
+
+	r, err := network.UserPacket(network.ReactionHead, "", content)
+	if err != nil {
+		s.fail("couldn't relay reaction", err, logger.Fields{"name": c.Name(), "message": id})
+		return
+	}
+	s.sendAll(r)
+}
+
+// Export writes the channel messages emitted between from and to in the given
+// format (see history.Export), read from the history file if there is one
+func (s *serv) Export(w io.Writer, from, to time.Time, format string) error {
+	records, err := s.history.Stored(s.name, from, to)
+	if err != nil {
+		return err
+	}
+	return history.Export(w, s.name, records, format)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// MetricsAddress is the editable local address the metrics endpoint listens
+// at, in the Prometheus text format. It is disabled if empty.
+// Default value = ""
+var MetricsAddress = ""
+
+// DispatchQueueSize is the editable amount of packets waiting to be
+// dispatched before the listener blocks
+// Default value = 64
+var DispatchQueueSize = 64
+
+// metrics are the server counters, updated atomically
+type metrics struct {
+	packetsIn  [256]int64
+	packetsOut [256]int64
+	bytesIn    int64
+	bytesOut   int64
+
+	retries  int64
+	timeouts int64
+
+	// packets dropped as their client sent them too often
+	rateLimited int64
+
+	// dispatch latency in nanoseconds
+	dispatched    int64
+	dispatchNanos int64
+}
+
+func (m *metrics) read(n int) {
+	atomic.AddInt64(&m.bytesIn, int64(n))
+}
+
+func (m *metrics) received(head byte) {
+	atomic.AddInt64(&m.packetsIn[head], 1)
+}
+
+func (m *metrics) sent(head byte, n int) {
+	atomic.AddInt64(&m.packetsOut[head], 1)
+	atomic.AddInt64(&m.bytesOut, int64(n))
+}
+
+// sendError counts the errors reported by server.Client.Send
+func (m *metrics) sendError(err error) {
+	switch err {
+	case server.ErrClientTimeout:
+		atomic.AddInt64(&m.timeouts, 1)
+	case server.ErrClientUnreachable, server.ErrClientUnavailable:
+		atomic.AddInt64(&m.retries, 1)
+	}
+}
+
+func (m *metrics) limited() {
+	atomic.AddInt64(&m.rateLimited, 1)
+}
+
+func (m *metrics) dispatch(d time.Duration) {
+	atomic.AddInt64(&m.dispatched, 1)
+	atomic.AddInt64(&m.dispatchNanos, int64(d))
+}
+
+func writeMetric(w io.Writer, name, kind, help string) {
+	io.WriteString(w, "# HELP "+name+" "+help+"\n# TYPE "+name+" "+kind+"\n")
+}
+
+func writeByHead(w io.Writer, name string, counts *[256]int64) {
+	for head := range counts {
+		if n := atomic.LoadInt64(&counts[head]); n > 0 {
+			io.WriteString(w, format("%s{head=\"%c\"} %d\n", name, head, n))
+		}
+	}
+}
+
+// writeMetrics writes the server metrics in the Prometheus text format
+func (s *serv) writeMetrics(w io.Writer) {
+	m := &s.metrics
+
+	writeMetric(w, "gochat_connected_clients", "gauge", "Number of connected clients.")
+	io.WriteString(w, format("gochat_connected_clients %d\n", s.clients.Size()))
+
+	writeMetric(w, "gochat_packets_received_total", "counter", "Packets received by head.")
+	writeByHead(w, "gochat_packets_received_total", &m.packetsIn)
+
+	writeMetric(w, "gochat_packets_sent_total", "counter", "Packets sent by head.")
+	writeByHead(w, "gochat_packets_sent_total", &m.packetsOut)
+
+	writeMetric(w, "gochat_received_bytes_total", "counter", "Bytes read from clients.")
+	io.WriteString(w, format("gochat_received_bytes_total %d\n", atomic.LoadInt64(&m.bytesIn)))
+
+	writeMetric(w, "gochat_sent_bytes_total", "counter", "Bytes sent to clients.")
+	io.WriteString(w, format("gochat_sent_bytes_total %d\n", atomic.LoadInt64(&m.bytesOut)))
+
+	writeMetric(w, "gochat_send_retries_total", "counter", "Failed attempts to send data to a client.")
+	io.WriteString(w, format("gochat_send_retries_total %d\n", atomic.LoadInt64(&m.retries)))
+
+	writeMetric(w, "gochat_client_timeouts_total", "counter", "Clients that could not be reached within MaxSendAttempts.")
+	io.WriteString(w, format("gochat_client_timeouts_total %d\n", atomic.LoadInt64(&m.timeouts)))
+
+	writeMetric(w, "gochat_rate_limited_total", "counter", "Packets dropped as their client sent them too often.")
+	io.WriteString(w, format("gochat_rate_limited_total %d\n", atomic.LoadInt64(&m.rateLimited)))
+
+	writeMetric(w, "gochat_dispatch_queue_depth", "gauge", "Packets waiting to be dispatched.")
+	io.WriteString(w, format("gochat_dispatch_queue_depth %d\n", len(s.pks)))
+
+	writeMetric(w, "gochat_dispatch_duration_seconds", "summary", "Time spent dispatching packets.")
+	io.WriteString(w, format("gochat_dispatch_duration_seconds_sum %g\n", time.Duration(atomic.LoadInt64(&m.dispatchNanos)).Seconds()))
+	io.WriteString(w, format("gochat_dispatch_duration_seconds_count %d\n", atomic.LoadInt64(&m.dispatched)))
+}
+
+// serveMetrics exposes the server metrics on MetricsAddress
+func (s *serv) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.writeMetrics(w)
+	})
+
+	s.info("metrics endpoint started", logger.Fields{"address": MetricsAddress})
+	if err := http.ListenAndServe(MetricsAddress, mux); err != nil {
+		s.fail("metrics endpoint stopped", err, logger.Fields{"address": MetricsAddress})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	s := newTestServer(t)
+
+	c := server.NewClient(uuid.UUID("joncena"), "joncena", "tcp", "127.0.0.1:1")
+	s.clients.Set(c.ID(), c)
+	p, _ := network.UserPacket(network.MessageHead, "", "hello")
+	s.pks <- p
+
+	s.metrics.read(40)
+	s.metrics.received(network.MessageHead)
+	s.metrics.received(network.MessageHead)
+	s.metrics.received(network.JoinHead)
+	s.metrics.sent(network.ServerHead, 25)
+	s.metrics.sendError(server.ErrClientUnreachable)
+	s.metrics.sendError(server.ErrClientTimeout)
+	s.metrics.dispatch(1500 * time.Millisecond)
+
+	// the second typing packet comes too soon
+	typing, _ := network.UserPacket(network.TypingHead, "", "joncena")
+	s.typing(typing)
+	s.typing(typing)
+
+	var buf bytes.Buffer
+	s.writeMetrics(&buf)
+
+	expected := `# HELP gochat_connected_clients Number of connected clients.
+# TYPE gochat_connected_clients gauge
+gochat_connected_clients 1
+# HELP gochat_packets_received_total Packets received by head.
+# TYPE gochat_packets_received_total counter
+gochat_packets_received_total{head="J"} 1
+gochat_packets_received_total{head="M"} 2
+# HELP gochat_packets_sent_total Packets sent by head.
+# TYPE gochat_packets_sent_total counter
+gochat_packets_sent_total{head="S"} 1
+# HELP gochat_received_bytes_total Bytes read from clients.
+# TYPE gochat_received_bytes_total counter
+gochat_received_bytes_total 40
+# HELP gochat_sent_bytes_total Bytes sent to clients.
+# TYPE gochat_sent_bytes_total counter
+gochat_sent_bytes_total 25
+# HELP gochat_send_retries_total Failed attempts to send data to a client.
+# TYPE gochat_send_retries_total counter
+gochat_send_retries_total 1
+# HELP gochat_client_timeouts_total Clients that could not be reached within MaxSendAttempts.
+# TYPE gochat_client_timeouts_total counter
+gochat_client_timeouts_total 1
+# HELP gochat_rate_limited_total Packets dropped as their client sent them too often.
+# TYPE gochat_rate_limited_total counter
+gochat_rate_limited_total 1
+# HELP gochat_dispatch_queue_depth Packets waiting to be dispatched.
+# TYPE gochat_dispatch_queue_depth gauge
+gochat_dispatch_queue_depth 1
+# HELP gochat_dispatch_duration_seconds Time spent dispatching packets.
+# TYPE gochat_dispatch_duration_seconds summary
+gochat_dispatch_duration_seconds_sum 1.5
+gochat_dispatch_duration_seconds_count 1
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition :\n%s", buf.String())
+	}
+
+	// every sample follows the TYPE line of its metric
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "_sum"), "_count")
+		if !typed[name] {
+			t.Errorf("sample %q has no TYPE line", line)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// Channel modes are set by operators with /mode, one flag at a time :
+//  	-> +i | -i			: invite-only, users join once given an /invite
+//  	-> +m | -m			: moderated, only /voice'd users talk
+//  	-> +k PASS | -k		: password, given by clients with network.KeyCapability
+//  	-> +l N | -l		: limit, at most N members
+//  	-> +s | -s			: secret, hidden from channel listings
+//
+// Operators aren't bound by modes.
+//
+
+// ErrWrongKey is returned to the clients joining a channel with a wrong or
+// missing password
+var ErrWrongKey = errors.New("channel requires a password")
+
+// contains tells whether name is one of list
+func contains(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns a copy of list without name
+func without(list []string, name string) []string {
+	var out []string
+	for _, n := range list {
+		if n != name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// modes returns the modes of ch, ie. +ikl 20. Its password is only shown if
+// secret is false.
+func (ch channel) modes(secret bool) string {
+	flags, args := "+", []string{}
+	if ch.InviteOnly {
+		flags += "i"
+	}
+	if ch.Moderated {
+		flags += "m"
+	}
+	if ch.Secret {
+		flags += "s"
+	}
+	if ch.Password != "" {
+		flags += "k"
+		if !secret {
+			args = append(args, ch.Password)
+		}
+	}
+	if ch.Limit > 0 {
+		flags += "l"
+		args = append(args, strconv.Itoa(ch.Limit))
+	}
+	return strings.Join(append([]string{flags}, args...), " ")
+}
+
+// admit checks the modes of the channel before c joins it
+func (s *serv) admit(c *server.Client, capabilities []string) error {
+	if c.Operator() {
+		return nil
+	}
+
+	key := ""
+	for _, capability := range capabilities {
+		if strings.HasPrefix(capability, network.KeyCapability) {
+			key = capability[len(network.KeyCapability):]
+		}
+	}
+
+	ch := s.channels.get(s.name)
+	switch {
+	case ch.Password != "" && subtle.ConstantTimeCompare([]byte(key), []byte(ch.Password)) != 1:
+		return ErrWrongKey
+	case ch.InviteOnly && !contains(ch.Invited, c.Name()):
+		return errors.New("channel " + s.name + " is invite-only")
+	case ch.Limit > 0 && s.clients.Size() >= ch.Limit:
+		return errors.New("channel " + s.name + " is full")
+	}
+	return nil
+}
+
+// mayTalk tells whether c may send messages to the channel, replying with a
+// permission error if it may not
+func (s *serv) mayTalk(c *server.Client) bool {
+	ch := s.channels.get(s.name)
+	if ch.Moderated && !c.Operator() && !contains(ch.Voiced, c.Name()) {
+		s.reply(c, network.PermissionErrorCode, "channel "+s.name+" is moderated, only voiced users can talk")
+		return false
+	}
+	return true
+}
+
+// operator returns the client of user if it is an operator
+func (s *serv) operator(user string) (*server.Client, error) {
+	c, ok := s.clients.Named(user)
+	if !ok || !c.Operator() {
+		return nil, errors.New("only operators can change the channel")
+	}
+	return c, nil
+}
+
+// changeChannel applies f to the channel, saves it and tells everyone
+func (s *serv) changeChannel(user, change string, f func(ch *channel)) {
+	if _, err := s.channels.update(s.name, f); err != nil {
+		s.fail("couldn't save channels", err, logger.Fields{"channel": s.name})
+	}
+	s.info("channel changed", logger.Fields{"channel": s.name, "name": user, "change": change})
+
+	p, err := network.ServerPacket(network.SuccessCode, user+" "+change)
+	if err != nil {
+		s.fail("couldn't announce channel change", err, logger.Fields{"channel": s.name})
+		return
+	}
+	s.sendAll(p)
+}
+
+// mode shows the modes of the channel, or changes them for operators
+//  	/mode [+i|-i|+m|-m|+k PASS|-k|+l N|-l|+s|-s...]
+func (s *serv) mode(user string, args []string) (string, error) {
+	if len(args) == 0 {
+		_, err := s.operator(user)
+		return "modes of " + s.name + " : " + s.channels.get(s.name).modes(err != nil), nil
+	}
+
+	if _, err := s.operator(user); err != nil {
+		return "", err
+	}
+
+	changes, err := parseModes(args)
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range changes {
+		announced := m.flag
+		if m.flag == "+l" {
+			announced += " " + m.arg
+		}
+
+		s.changeChannel(user, "set "+announced+" on "+s.name, m.apply)
+	}
+	return "", nil
+}
+
+// modeChange is a mode flag given to /mode, along with its argument
+type modeChange struct {
+	flag string
+	arg  string
+}
+
+// parseModes reads mode flags, ie. +i +k PASS +l 20, checking every flag
+// before any is applied
+func parseModes(args []string) ([]modeChange, error) {
+	var changes []modeChange
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		switch flag {
+		case "+i", "-i", "+m", "-m", "+s", "-s", "-k", "-l":
+			changes = append(changes, modeChange{flag, ""})
+		case "+k", "+l":
+			if i+1 == len(args) {
+				return nil, errors.New(flag + " requires an argument")
+			}
+			i++
+			if n, err := strconv.Atoi(args[i]); flag == "+l" && (err != nil || n < 1) {
+				return nil, errors.New("+l requires a positive limit")
+			}
+			changes = append(changes, modeChange{flag, args[i]})
+		default:
+			return nil, errors.New("unknown mode " + flag + ", see /help")
+		}
+	}
+	return changes, nil
+}
+
+// apply sets the mode on ch
+func (m modeChange) apply(ch *channel) {
+	on := m.flag[0] == '+'
+	switch m.flag[1] {
+	case 'i':
+		ch.InviteOnly = on
+	case 'm':
+		ch.Moderated = on
+	case 's':
+		ch.Secret = on
+	case 'k':
+		ch.Password = m.arg
+	case 'l':
+		ch.Limit, _ = strconv.Atoi(m.arg)
+	}
+}
+
+// invite lets a user join the invite-only channel, or takes the invitation
+// back
+//  	/invite NAME, /uninvite NAME
+func (s *serv) invite(user string, args []string) (string, error) {
+	return s.list(user, args, "invite", true, func(ch *channel) *[]string { return &ch.Invited })
+}
+
+func (s *serv) uninvite(user string, args []string) (string, error) {
+	return s.list(user, args, "uninvite", false, func(ch *channel) *[]string { return &ch.Invited })
+}
+
+// voice lets a user talk in the moderated channel, or takes it back
+//  	/voice NAME, /devoice NAME
+func (s *serv) voice(user string, args []string) (string, error) {
+	return s.list(user, args, "voice", true, func(ch *channel) *[]string { return &ch.Voiced })
+}
+
+func (s *serv) devoice(user string, args []string) (string, error) {
+	return s.list(user, args, "devoice", false, func(ch *channel) *[]string { return &ch.Voiced })
+}
+
+// list adds a name to one of the lists of the channel given by field, or
+// removes it
+func (s *serv) list(user string, args []string, command string, add bool, field func(ch *channel) *[]string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: " + command + " NAME")
+	}
+	if _, err := s.operator(user); err != nil {
+		return "", err
+	}
+
+	name := args[0]
+	s.changeChannel(user, command+"d "+name+" on "+s.name, func(ch *channel) {
+		list := field(ch)
+		*list = without(*list, name)
+		if add {
+			*list = append(*list, name)
+		}
+	})
+	return "", nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/server/client"
+)
+
+func TestChannelModes(t *testing.T) {
+	s := newTestServer(t)
+
+	op := server.NewClient(uuid.UUID("op"), "joncena", "tcp", "127.0.0.1:1")
+	op.SetOperator(true)
+	s.clients.Set(op.ID(), op)
+
+	if _, err := s.mode("joncena", []string{"+i", "+k", "hunter2", "+l"}); err == nil {
+		t.Error("a missing limit should be rejected")
+	}
+	if _, err := s.mode("joncena", []string{"+i", "+k", "hunter2", "+l", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if modes := s.channels.get(s.name).modes(true); modes != "+ikl 2" {
+		t.Errorf("unexpected modes %q", modes)
+	}
+
+	guest := server.NewClient(uuid.UUID("guest"), "Springwater64", "tcp", "127.0.0.1:2")
+	if err := s.admit(guest, []string{"key=hunter2"}); err == nil {
+		t.Error("uninvited users shouldn't join an invite-only channel")
+	}
+
+	s.invite("joncena", []string{"Springwater64"})
+	if err := s.admit(guest, nil); err != ErrWrongKey {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	if err := s.admit(guest, []string{"key=hunter2"}); err != nil {
+		t.Errorf("invited user with the password was refused : %v", err)
+	}
+
+	s.clients.Set(guest.ID(), guest)
+	late := server.NewClient(uuid.UUID("late"), "Lobby", "tcp", "127.0.0.1:3")
+	s.mode("joncena", []string{"-i", "-k"})
+	if err := s.admit(late, nil); err == nil {
+		t.Error("users shouldn't join a full channel")
+	}
+
+	if _, err := s.mode("Springwater64", []string{"-l"}); err == nil {
+		t.Error("only operators should change modes")
+	}
+}
+
+func TestChannelDefaults(t *testing.T) {
+	topic, modes := ChannelTopic, ChannelModes
+	t.Cleanup(func() { ChannelTopic, ChannelModes = topic, modes })
+	ChannelTopic, ChannelModes = "deploys only", "+m +l 20"
+
+	s := newTestServer(t)
+
+	ch := s.channels.get(s.name)
+	if ch.Topic != "deploys only" || ch.TopicSetBy != "ChatRoom" {
+		t.Errorf("unexpected default topic %q set by %q", ch.Topic, ch.TopicSetBy)
+	}
+	if modes := ch.modes(true); modes != "+ml 20" {
+		t.Errorf("unexpected default modes %q", modes)
+	}
+}
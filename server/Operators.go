@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// OperatorPassword is the editable password users give to /oper to become
+// operators, /oper is disabled if empty
+// Default value = ""
+var OperatorPassword = ""
+
+// Operators are the editable logins of the Unix socket users, who are
+// authenticated, that are operators as soon as they join
+// Default value = none
+var Operators []string
+
+// isOperator tells whether login is one of Operators
+func isOperator(login string) bool {
+	for _, o := range Operators {
+		if o == login {
+			return true
+		}
+	}
+	return false
+}
+
+// oper makes user an operator given the right password
+//  	/oper PASSWORD
+func (s *serv) oper(user string, args []string) (string, error) {
+	if OperatorPassword == "" {
+		return "", errors.New("operators can't log in on this server")
+	}
+	if len(args) != 1 {
+		return "", errors.New("usage: oper PASSWORD")
+	}
+
+	c, ok := s.clients.Named(user)
+	if !ok {
+		return "", errors.New("unknown user " + user)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(OperatorPassword)) != 1 {
+		s.warn("wrong operator password", clientFields(c))
+		return "", errors.New("wrong password")
+	}
+
+	c.SetOperator(true)
+	s.info("user became operator", logger.Fields{"name": user})
+	return "you are now an operator", nil
+}
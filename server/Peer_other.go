@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID returns the user id of the process at the other end of a Unix
+// domain socket connection
+func peerUID(conn net.Conn) (string, error) {
+	return "", errors.New("peer credentials are not supported on this platform")
+}
+
+// socketOwner returns the user id owning the socket file at path
+func socketOwner(path string) (string, error) {
+	return "", errors.New("socket ownership is not supported on this platform")
+}
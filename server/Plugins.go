@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/logger"
+	"github.com/Spriithy/gochat-term/server/plugin"
+)
+
+// PluginSocket is the editable path of the Unix domain socket out-of-process
+// plugins connect to. It is disabled if empty.
+// Default value = ""
+var PluginSocket = ""
+
+// serverOwner owns the commands built into the server
+const serverOwner = "server"
+
+// pluginHost is the server as seen by a plugin
+type pluginHost struct {
+	s    *serv
+	name string
+}
+
+func (h pluginHost) OnJoin(f plugin.JoinHook)       { h.s.hooks.OnJoin(h.name, f) }
+func (h pluginHost) OnLeave(f plugin.LeaveHook)     { h.s.hooks.OnLeave(h.name, f) }
+func (h pluginHost) OnMessage(f plugin.MessageHook) { h.s.hooks.OnMessage(h.name, f) }
+func (h pluginHost) OnWhisper(f plugin.WhisperHook) { h.s.hooks.OnWhisper(h.name, f) }
+
+func (h pluginHost) Command(name, usage string, f plugin.CommandFunc) error {
+	return h.s.hooks.Command(h.name, name, usage, f)
+}
+
+func (h pluginHost) Every(d time.Duration, f func()) {
+	go func() {
+		for range time.Tick(d) {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						h.s.warn("plugin timer panicked", logger.Fields{"plugin": h.name, "error": r})
+					}
+				}()
+				f()
+			}()
+		}
+	}()
+}
+
+func (h pluginHost) Say(text string) {
+	h.s.broadcast(h.name, "", text)
+}
+
+func (h pluginHost) Tell(user, text string) error {
+	c, ok := h.s.clients.Named(user)
+	if !ok {
+		return errors.New("unknown user " + user)
+	}
+
+	p, err := network.UserPacket(network.WhisperHead, "", h.name+" "+text)
+	if err != nil {
+		return err
+	}
+	h.s.send(c, p)
+	return nil
+}
+
+// loadPlugin initializes p, dropping its hooks if it fails
+func (s *serv) loadPlugin(p plugin.Plugin) error {
+	if p.Name() == serverOwner || !s.hooks.Add(p.Name()) {
+		return errors.New("plugin " + p.Name() + " is already loaded")
+	}
+
+	if err := p.Init(pluginHost{s, p.Name()}); err != nil {
+		s.hooks.Remove(p.Name())
+		return err
+	}
+
+	s.info("plugin loaded", logger.Fields{"plugin": p.Name()})
+	return nil
+}
+
+// loadPlugins loads the registered plugins, and accepts out-of-process ones
+// on PluginSocket
+func (s *serv) loadPlugins() {
+	for _, p := range plugin.Plugins() {
+		if err := s.loadPlugin(p); err != nil {
+			s.fail("couldn't load plugin", err, logger.Fields{"plugin": p.Name()})
+		}
+	}
+
+	if PluginSocket != "" {
+		go s.servePlugins()
+	}
+}
+
+// servePlugins accepts out-of-process plugins on PluginSocket
+func (s *serv) servePlugins() {
+	removeStaleSocket(PluginSocket)
+	l, err := net.Listen("unix", PluginSocket)
+	if err != nil {
+		s.fail("couldn't listen for plugins", err, logger.Fields{"address": PluginSocket})
+		return
+	}
+	defer l.Close()
+
+	// plugins see every message, only the server's user may connect
+	if err := os.Chmod(PluginSocket, 0600); err != nil {
+		s.fail("couldn't listen for plugins", err, logger.Fields{"address": PluginSocket})
+		return
+	}
+
+	s.info("plugin socket open", logger.Fields{"address": PluginSocket})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.fail("couldn't accept plugin", err, nil)
+			continue
+		}
+		go s.remotePlugin(conn)
+	}
+}
+
+// remotePlugin loads an out-of-process plugin until it disconnects
+func (s *serv) remotePlugin(conn net.Conn) {
+	r, err := plugin.NewRemote(conn)
+	if err != nil {
+		s.warn("plugin refused", logger.Fields{"error": err})
+		conn.Close()
+		return
+	}
+
+	if err := s.loadPlugin(r); err != nil {
+		s.fail("couldn't load plugin", err, logger.Fields{"plugin": r.Name()})
+		conn.Close()
+		return
+	}
+
+	<-r.Done()
+	s.hooks.Remove(r.Name())
+	s.info("plugin disconnected", logger.Fields{"plugin": r.Name()})
+}
+
+// command runs a command of the server or of a plugin, and answers the
+// result to its issuer
+// Content : ID NAME [ARGS...]
+func (s *serv) command(p network.Packet) {
+	c, fields, ok := s.sender(p, 2)
+	if !ok {
+		return
+	}
+
+	args := strings.Fields(fields[0])
+	if len(args) == 0 {
+		return
+	}
+
+	answer, err := s.hooks.Run(c.Name(), args[0], args[1:])
+	switch {
+	case err == plugin.ErrUnknownCommand:
+		s.reply(c, network.RequestErrorCode, "unknown command "+args[0])
+	case err != nil:
+		s.reply(c, network.RequestErrorCode, args[0]+" : "+err.Error())
+	case answer != "":
+		s.reply(c, network.SuccessCode, answer)
+	}
+}
+
+// help lists the commands of the server and of its plugins
+func (s *serv) help(user string, args []string) (string, error) {
+	var lines []string
+	for _, c := range s.hooks.Commands() {
+		lines = append(lines, "/"+c.Usage)
+	}
+	return "commands :\n  " + strings.Join(lines, "\n  "), nil
+}
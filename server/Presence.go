@@ -0,0 +1,195 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// IdleAfter is the editable inactivity after which online users become idle,
+// 0 disables idleness
+// Default value = 10 minutes
+var IdleAfter = 10 * time.Minute
+
+// TypingInterval is the editable interval under which the typing packets of a
+// client are dropped, as clients may not throttle them
+// Default value = 2s
+var TypingInterval = 2 * time.Second
+
+// presence sets the status of a client
+// Content : ID STATUS [NOTE]
+func (s *serv) presence(p network.Packet) {
+	c, fields, ok := s.sender(p, 2)
+	if !ok {
+		return
+	}
+
+	parts := strings.SplitN(fields[0], " ", 2)
+	if !network.IsSettableStatus(parts[0]) {
+		s.reply(c, network.RequestErrorCode, "status must be one of online, away or dnd")
+		return
+	}
+
+	note := ""
+	if len(parts) == 2 {
+		note = parts[1]
+	}
+	s.setStatus(c, parts[0], note)
+}
+
+// setStatus changes the status of c and announces it
+func (s *serv) setStatus(c *server.Client, status, note string) {
+	if old, oldNote := c.Status(); old == status && oldNote == note {
+		return
+	}
+
+	c.SetStatus(status, note)
+	s.announce(c.Name(), status, note)
+}
+
+// announce broadcasts the status of a user
+func (s *serv) announce(name, status, note string) {
+	content := name + " " + status
+	if note != "" {
+		content += " " + note
+	}
+
+	p, err := network.UserPacket(network.PresenceHead, "", content)
+	if err != nil {
+		s.fail("couldn't announce status", err, logger.Fields{"name": name, "status": status})
+		return
+	}
+	s.sendAll(p)
+}
+
+// members sends the status of every other client to c
+func (s *serv) members(c *server.Client) {
+	for m := range s.clients.Iter() {
+		if m == c {
+			continue
+		}
+
+		status, note := m.Status()
+		content := m.Name() + " " + status
+		if note != "" {
+			content += " " + note
+		}
+
+		p, err := network.UserPacket(network.PresenceHead, "", content)
+		if err != nil {
+			s.fail("couldn't send member list", err, clientFields(c))
+			return
+		}
+		s.send(c, p)
+	}
+}
+
+// active records the activity of c, which is no longer idle
+func (s *serv) active(c *server.Client) {
+	c.Touch()
+	if status, _ := c.Status(); status == network.Idle {
+		s.setStatus(c, network.Online, "")
+	}
+}
+
+// watchIdle marks the online clients without activity for IdleAfter as idle
+func (s *serv) watchIdle() {
+	for range time.Tick(time.Minute) {
+		s.do(s.markIdle)
+	}
+}
+
+func (s *serv) markIdle() {
+	if IdleAfter <= 0 {
+		return
+	}
+
+	for c := range s.clients.Iter() {
+		if status, _ := c.Status(); status == network.Online && time.Since(c.Active()) > IdleAfter {
+			s.setStatus(c, network.Idle, "")
+		}
+	}
+}
+
+// who lists the users and their status
+func (s *serv) who(user string, args []string) (string, error) {
+	var lines []string
+	for c := range s.clients.Iter() {
+		status, note := c.Status()
+		line := c.Name() + " : " + status
+		if note != "" {
+			line += " (" + note + ")"
+		}
+		if idle := time.Since(c.Active()); idle >= time.Minute {
+			line += format(", idle for %s", idle.Truncate(time.Minute))
+		}
+		lines = append(lines, line)
+	}
+
+	sort.Strings(lines)
+	return format("%d users on %s :\n  %s", len(lines), s.name, strings.Join(lines, "\n  ")), nil
+}
+
+// autoReply warns the sender of a whisper that its recipient is away or
+// doesn't want to be disturbed
+func (s *serv) autoReply(from, to *server.Client) {
+	status, note := to.Status()
+	if note != "" {
+		note = " : " + note
+	}
+
+	switch status {
+	case network.Away:
+		s.reply(from, network.SuccessCode, to.Name()+" is away"+note)
+	case network.DoNotDisturb:
+		s.reply(from, network.SuccessCode, to.Name()+" doesn't want to be disturbed"+note)
+	}
+}
+
+// typing relays that a client is typing to the channel, or to the recipient
+// of a whisper, at most once per TypingInterval. It is never recorded.
+// Content : ID [to]
+func (s *serv) typing(p network.Packet) {
+	fields := strings.Fields(p.Content())
+	if len(fields) == 0 || len(fields) > 2 {
+		return
+	}
+
+	c, ok := s.clients.Get(uuid.UUID(fields[0]))
+	if !ok {
+		return
+	}
+	s.active(c)
+	if !c.Typing(TypingInterval) {
+		s.metrics.limited()
+		return
+	}
+
+	if len(fields) == 2 {
+		to, ok := s.clients.Named(fields[1])
+		if !ok {
+			return
+		}
+
+		r, err := network.UserPacket(network.TypingHead, "", c.Name()+" whisper")
+		if err == nil {
+			s.send(to, r)
+		}
+		return
+	}
+
+	r, err := network.UserPacket(network.TypingHead, "", c.Name())
+	if err != nil {
+		return
+	}
+	for m := range s.clients.Iter() {
+		if m != c {
+			s.send(m, r)
+		}
+	}
+}
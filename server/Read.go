@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// ReadPath is the editable path of the file the read markers of users are
+// saved to, they are kept in memory only if it is empty
+// Default value = read.json
+var ReadPath = "read.json"
+
+// MaxReplay is the editable amount of unread messages replayed to the users
+// coming back, the oldest ones being skipped
+// Default value = 100
+var MaxReplay = 100
+
+// readMap keeps the id of the last channel message every user read, by name
+// then channel. Markers only move forward, ids sorting like the messages.
+type readMap struct {
+	sync.Mutex
+	path    string
+	markers map[string]map[string]string
+}
+
+// loadReadMarkers reads the markers saved to path, which may not exist yet
+func loadReadMarkers(path string) (*readMap, error) {
+	m := &readMap{path: path, markers: make(map[string]map[string]string)}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &m.markers); err != nil {
+		return nil, errors.New("corrupted read markers file " + path + " : " + err.Error())
+	}
+	return m, nil
+}
+
+// get returns the id of the last message name read in channel, if any
+func (m *readMap) get(name, channel string) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.markers[name][channel]
+}
+
+// mark moves the marker of name in channel to id, and saves the markers. It
+// tells whether the marker moved.
+func (m *readMap) mark(name, channel, id string) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if id <= m.markers[name][channel] {
+		return false, nil
+	}
+	if m.markers[name] == nil {
+		m.markers[name] = make(map[string]string)
+	}
+	m.markers[name][channel] = id
+
+	if m.path == "" {
+		return true, nil
+	}
+	return true, saveJSON(m.path, m.markers)
+}
+
+// readers returns the names of the users who read the message id of channel
+func (m *readMap) readers(channel, id string) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	var names []string
+	for name, markers := range m.markers {
+		if markers[channel] >= id {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unread returns the channel messages of the others name didn't read, after
+// its marker. Users who never read the channel have no unread messages.
+func (s *serv) unread(name, marker string) []history.Record {
+	if marker == "" {
+		return nil
+	}
+
+	var out []history.Record
+	for _, r := range s.history.Range(s.name, time.Time{}, time.Time{}) {
+		if r.ID > marker && r.Head == string(network.MessageHead) && r.Name != name {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// readMarker tells a client joining the last message it read and how many
+// were sent since, so it can ask for them
+func (s *serv) readMarker(c *server.Client) {
+	marker := s.reads.get(c.Name(), s.name)
+	n := len(s.unread(c.Name(), marker))
+	if n == 0 {
+		return
+	}
+
+	p, err := network.UserPacket(network.ReadHead, "", format("%s %s %d", c.Name(), marker, n))
+	if err != nil {
+		s.fail("couldn't send read marker", err, clientFields(c))
+		return
+	}
+	s.send(c, p)
+}
+
+// read moves the read marker of a client, telling the others, or replays the
+// messages it didn't read. Markers are sent by the clients themselves, so
+// they aren't activity.
+// Content : ID [MSGID]
+func (s *serv) read(p network.Packet) {
+	fields := strings.Fields(p.Content())
+	if len(fields) == 0 || len(fields) > 2 {
+		return
+	}
+
+	c, ok := s.clients.Get(uuid.UUID(fields[0]))
+	if !ok {
+		return
+	}
+
+	if len(fields) == 1 {
+		s.replay(c)
+		return
+	}
+
+	// messages deleted meanwhile are skipped
+	if _, ok := s.history.Get(fields[1]); ok {
+		s.markRead(c, fields[1])
+	}
+}
+
+// markRead moves the read marker of c to the message id, and sends the read
+// receipt to the others
+func (s *serv) markRead(c *server.Client, id string) {
+	moved, err := s.reads.mark(c.Name(), s.name, id)
+	if err != nil {
+		s.fail("couldn't save read markers", err, clientFields(c))
+	}
+	if !moved {
+		return
+	}
+
+	p, err := network.UserPacket(network.ReadHead, "", c.Name()+" "+id)
+	if err != nil {
+		s.fail("couldn't send read receipt", err, clientFields(c))
+		return
+	}
+	for other := range s.clients.Iter() {
+		if other.ID() != c.ID() {
+			s.send(other, p)
+		}
+	}
+}
+
+// replay sends a client the last MaxReplay messages it didn't read
+func (s *serv) replay(c *server.Client) {
+	unread := s.unread(c.Name(), s.reads.get(c.Name(), s.name))
+	if len(unread) > MaxReplay {
+		unread = unread[len(unread)-MaxReplay:]
+	}
+
+	for _, r := range unread {
+		p, err := messagePacket(r)
+		if err != nil {
+			s.fail("couldn't replay message", err, logger.Fields{"name": c.Name(), "message": r.ID})
+			continue
+		}
+		s.send(c, p)
+	}
+}
+
+// seen lists the users who read a message, our last one by default. Messages
+// are given by the end of their id, ie. #3f2a.
+//  	/seen [#REF]
+func (s *serv) seen(user string, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("usage: seen [#REF]")
+	}
+
+	reference := ""
+	if len(args) == 1 {
+		reference = strings.TrimPrefix(args[0], "#")
+	}
+
+	records := s.history.Range(s.name, time.Time{}, time.Time{})
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.Head != string(network.MessageHead) {
+			continue
+		}
+		if reference == "" && r.Name != user || reference != "" && !strings.HasSuffix(r.ID, reference) {
+			continue
+		}
+
+		var readers []string
+		for _, name := range s.reads.readers(s.name, r.ID) {
+			if name != r.Name {
+				readers = append(readers, name)
+			}
+		}
+		if len(readers) == 0 {
+			return "nobody read " + r.Name + ": " + history.Excerpt(r.Content) + " yet", nil
+		}
+		return r.Name + ": " + history.Excerpt(r.Content) + " was read by " + strings.Join(readers, ", "), nil
+	}
+	return "", errors.New("no such message")
+}
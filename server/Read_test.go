@@ -0,0 +1,39 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMarkers(t *testing.T) {
+	s := newTestServer(t)
+
+	s.broadcast("joncena", "", "first")
+	first := s.history.Range(s.name, time.Time{}, time.Time{})[0].ID
+	s.broadcast("Springwater64", "", "second")
+	s.broadcast("joncena", "", "third")
+
+	if unread := s.unread("Lobby", ""); len(unread) != 0 {
+		t.Errorf("users who never read the channel shouldn't have unread messages : %v", unread)
+	}
+
+	s.reads.mark("Springwater64", s.name, first)
+	unread := s.unread("Springwater64", s.reads.get("Springwater64", s.name))
+	if len(unread) != 1 || unread[0].Content != "third" {
+		t.Errorf("unexpected unread messages %+v", unread)
+	}
+
+	last := unread[0].ID
+	s.reads.mark("Lobby", s.name, last)
+	if moved, _ := s.reads.mark("Lobby", s.name, first); moved {
+		t.Error("read markers shouldn't move back")
+	}
+	if readers := s.reads.readers(s.name, first); strings.Join(readers, ",") != "Lobby,Springwater64" {
+		t.Errorf("unexpected readers %v", readers)
+	}
+
+	if seen, _ := s.seen("joncena", nil); seen != "joncena: third was read by Lobby" {
+		t.Errorf("unexpected /seen answer %q", seen)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// liveSettings are the settings Reload applies in place, the others require
+// the server to be restarted. Packet sizes are read by every connection, and
+// can't change safely.
+var liveSettings = map[string]bool{
+	"server.motd":              true,
+	"server.compression":       true,
+	"limits.max_transfer_size": true,
+	"limits.max_history":       true,
+	"limits.max_mentions":      true,
+	"limits.max_replay":        true,
+	"presence.idle_minutes":    true,
+	"operators.password":       true,
+	"operators.users":          true,
+	"log.level":                true,
+	"log.format":               true,
+	"log.file":                 true,
+	"log.max_size":             true,
+	"log.backups":              true,
+}
+
+// diff returns the keys of the settings of c changed in next, split between
+// the ones that can change live and the ones requiring a restart
+func (c *Config) diff(next *Config) (live, restart []string) {
+	current, updated := c.settings(), next.settings()
+	for i, s := range current {
+		if s.String() == updated[i].String() {
+			continue
+		}
+
+		if liveSettings[s.key] {
+			live = append(live, s.key)
+		} else {
+			restart = append(restart, s.key)
+		}
+	}
+	return live, restart
+}
+
+// SetReloader sets the function reading the configuration again on Reload,
+// typically by calling ParseConfig with the original arguments
+func (s *serv) SetReloader(load func() (*Config, error)) {
+	s.reload = load
+}
+
+// Reload reads the configuration again and applies the settings that can
+// change while the server runs. Changes to the other settings are reported
+// and ignored until the server is restarted. Settings are applied on the
+// dispatch goroutine, between two packets.
+func (s *serv) Reload() error {
+	var err error
+	s.do(func() { err = s.reloadConfig() })
+	return err
+}
+
+func (s *serv) reloadConfig() error {
+	if s.reload == nil || s.config == nil {
+		return errors.New("server has no configuration to reload")
+	}
+
+	next, err := s.reload()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		s.fail("couldn't reload configuration", err, nil)
+		return err
+	}
+
+	live, restart := s.config.diff(next)
+	if len(restart) > 0 {
+		s.warn("settings require a restart", logger.Fields{"settings": strings.Join(restart, ",")})
+	}
+
+	c := *s.config
+	settings, updated := c.settings(), next.settings()
+	for i, setting := range settings {
+		if liveSettings[setting.key] {
+			setting.Set(updated[i].String())
+		}
+	}
+
+	for _, key := range live {
+		if strings.HasPrefix(key, "log.") {
+			l, f, err := c.logger()
+			if err != nil {
+				s.fail("couldn't reload configuration", err, logger.Fields{"settings": key})
+				return err
+			}
+
+			// the previous logger is unused once SetLogger returns
+			old := s.logFile
+			s.SetLogger(l)
+			s.logFile = f
+			if old != nil {
+				old.Close()
+			}
+			break
+		}
+	}
+
+	c.apply()
+	s.history.SetMax(c.MaxHistory)
+	s.config = &c
+
+	s.info("configuration reloaded", logger.Fields{"changed": strings.Join(live, ",")})
+	return nil
+}
+
+// reloadOnHangup reloads the configuration whenever the process receives
+// SIGHUP
+func (s *serv) reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		s.Reload()
+	}
+}
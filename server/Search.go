@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/gochat-term/history"
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// IndexPath is the editable path of the file the search index of the history
+// is saved to, it is kept in memory only if empty
+// Default value = history.index
+var IndexPath = "history.index"
+
+// searchPageSize is the amount of messages of a page of search results
+const searchPageSize = 10
+
+// indexHistory indexes the messages of the history when the index is new,
+// ie. the first time the server runs with it
+func (s *serv) indexHistory() error {
+	if s.index.Len() > 0 {
+		return nil
+	}
+
+	records := s.history.Range("", time.Time{}, time.Time{})
+	if HistoryPath != "" {
+		var err error
+		records, err = history.Load(HistoryPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for _, r := range records {
+		if r.Head != string(network.MessageHead) {
+			continue
+		}
+		if err := s.index.Add(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mayRead tells whether c may read the messages of a channel. Members read
+// their channel, the others the channels without modes keeping them out.
+func (s *serv) mayRead(c *server.Client, channel string) bool {
+	if c.Operator() || channel == s.name {
+		return true
+	}
+
+	ch := s.channels.get(channel)
+	return !ch.Secret && ch.Password == "" && (!ch.InviteOnly || contains(ch.Invited, c.Name()))
+}
+
+// search finds the channel messages holding every word, the most recent
+// first, among the channels user may read
+//  	/search [in:CHANNEL] [by:NAME] [after:TIME] [before:TIME] [page:N] WORDS...
+func (s *serv) search(user string, args []string) (string, error) {
+	c, ok := s.clients.Named(user)
+	if !ok {
+		return "", errors.New("only users can search")
+	}
+
+	q := history.Query{Allow: func(channel string) bool { return s.mayRead(c, channel) }}
+	page := 1
+	var terms []string
+	for _, arg := range args {
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "in:"):
+			q.Channel = strings.TrimPrefix(arg[len("in:"):], "#")
+		case strings.HasPrefix(arg, "by:"):
+			q.Name = arg[len("by:"):]
+		case strings.HasPrefix(arg, "after:"):
+			q.From, err = history.ParseTime(arg[len("after:"):])
+		case strings.HasPrefix(arg, "before:"):
+			q.To, err = history.ParseTime(arg[len("before:"):])
+		case strings.HasPrefix(arg, "page:"):
+			page, err = strconv.Atoi(arg[len("page:"):])
+			if err == nil && page < 1 {
+				err = errors.New("invalid page " + arg[len("page:"):])
+			}
+			continue
+		default:
+			q.Words = append(q.Words, arg)
+		}
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, arg)
+	}
+	if len(terms) == 0 {
+		return "", errors.New("usage: search [in:CHANNEL] [by:NAME] [after:TIME] [before:TIME] [page:N] WORDS...")
+	}
+
+	ids := s.index.Search(q)
+	if len(ids) == 0 {
+		return "no messages found", nil
+	}
+
+	total := len(ids)
+	pages := (total + searchPageSize - 1) / searchPageSize
+	if page > pages {
+		return "", errors.New(format("there are only %d pages of results", pages))
+	}
+	ids = ids[(page-1)*searchPageSize:]
+	if len(ids) > searchPageSize {
+		ids = ids[:searchPageSize]
+	}
+
+	records, err := s.history.Lookup(ids)
+	if err != nil {
+		s.fail("couldn't read history", err, logger.Fields{"name": user})
+		return "", errors.New("couldn't read history")
+	}
+
+	lines := make([]string, len(records))
+	for i, r := range records {
+		lines[i] = format("[%s] #%s <%s in %s> %s", r.Time.Format("2006-01-02 15:04"), r.ID[len(r.ID)-4:], r.Name, r.Channel, history.Excerpt(r.Content))
+	}
+	answer := format("%d messages found, page %d of %d :\n  %s", total, page, pages, strings.Join(lines, "\n  "))
+	if page < pages {
+		answer += format("\n/search page:%d %s for more", page+1, strings.Join(terms, " "))
+	}
+	return answer, nil
+}
@@ -1,15 +1,24 @@
 package server
 
 import (
+	"errors"
+	"io"
 	"net"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"fmt"
 
 	"github.com/Spriithy/go-colors"
 	"github.com/Spriithy/go-uuid"
+	"github.com/Spriithy/gochat-term/history"
 	"github.com/Spriithy/gochat-term/network"
 	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/irc"
+	"github.com/Spriithy/gochat-term/server/logger"
+	"github.com/Spriithy/gochat-term/server/plugin"
 )
 
 var bold = colors.Bold
@@ -18,12 +27,16 @@ var none = colors.None
 // fmt.Sprintf alias for code readability
 var format = fmt.Sprintf
 
-// Here Returns the local address
+// AllowCompression tells whether the server accepts to compress the packets
+// it sends to clients supporting it
+var AllowCompression = true
+
+// Here Returns the first non-loopback IPv4 address of the host, or the
+// loopback address if there is none
 func Here() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		println(colors.Red(bold, "Error recording net interfaces :", err.Error()))
-		os.Exit(1)
+		return "127.0.0.1"
 	}
 
 	for _, addr := range addrs {
@@ -40,147 +53,505 @@ func Here() string {
 // Server is a basic Server wrapper interface
 //
 type Server interface {
-	Log(...interface{})
-	Logln(...interface{})
-	Error(...interface{})
+	SetLogger(logger.Logger)
+	SetReloader(func() (*Config, error))
+	Reload() error
+	Export(w io.Writer, from, to time.Time, format string) error
 	Start()
 	Quit()
 }
 
 type serv struct {
-	name string
-	ip   string
-	port int
+	name  string
+	addrs []listenAddr
 
 	running bool
 
-	pks chan network.Packet
+	config  *Config
+	reload  func() (*Config, error)
+	logLock sync.RWMutex
+	logger  logger.Logger
+	logFile io.Closer
+
+	clients   *server.ClientMap
+	transfers *transferMap
+	history   *history.Store
+	hooks     *plugin.Hooks
+	mentions  *mentionMap
+	channels  *channelMap
+	reads     *readMap
+	index     *history.Index
+
+	pks   chan network.Packet
+	tasks chan func()
+	errs  chan error
+	frags *network.Reassembler
+
+	metrics metrics
 }
 
 // NewServer creates a new instance of a Server struct on the given port
 //
 func NewServer(name string, port int) Server {
+	s, err := newServer(name, []string{Here()}, port)
+	if err != nil {
+		println(colors.Red(bold, "Error creating server :", err.Error()))
+		os.Exit(1)
+	}
+	return s
+}
+
+// newServer creates a server listening at every address of addrs, port
+// being used by the addresses that have none
+func newServer(name string, addrs []string, port int) (*serv, error) {
 	s := new(serv)
 	s.name = name
-	s.ip = Here()
-	s.port = port
+	for _, addr := range addrs {
+		a, err := parseListenAddr(addr, port)
+		if err != nil {
+			return nil, err
+		}
+		s.addrs = append(s.addrs, a)
+	}
 
 	s.running = false
 
-	s.pks = make(chan network.Packet)
+	s.logger = logger.New(os.Stdout, logger.Text, logger.Info)
+
+	s.clients = server.NewClientMap()
+	s.transfers = newTransferMap()
+	s.hooks = plugin.NewHooks()
+	s.mentions = newMentionMap()
+	s.hooks.Command(serverOwner, "help", "help", s.help)
+	s.hooks.Command(serverOwner, "who", "who", s.who)
+	s.hooks.Command(serverOwner, "oper", "oper PASSWORD", s.oper)
+	s.hooks.Command(serverOwner, "mentions", "mentions", s.listMentions)
+	s.hooks.Command(serverOwner, "topic", "topic [TOPIC]", s.topic)
+	s.hooks.Command(serverOwner, "mode", "mode [+i|-i|+m|-m|+k PASS|-k|+l N|-l|+s|-s...]", s.mode)
+	s.hooks.Command(serverOwner, "invite", "invite NAME", s.invite)
+	s.hooks.Command(serverOwner, "uninvite", "uninvite NAME", s.uninvite)
+	s.hooks.Command(serverOwner, "voice", "voice NAME", s.voice)
+	s.hooks.Command(serverOwner, "devoice", "devoice NAME", s.devoice)
+	s.hooks.Command(serverOwner, "seen", "seen [#REF]", s.seen)
+	s.hooks.Command(serverOwner, "search", "search [in:CHANNEL] [by:NAME] [after:TIME] [before:TIME] [page:N] WORDS...", s.search)
+
+	var err error
+	s.history, err = history.NewStore(HistoryPath, MaxHistory)
+	if err != nil {
+		return nil, err
+	}
 
-	return s
+	s.channels, err = loadChannels(ChannelsPath)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := s.defaultChannel()
+	if err != nil {
+		return nil, err
+	}
+	s.channels.setDefault(ch)
+
+	s.reads, err = loadReadMarkers(ReadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.index, err = history.OpenIndex(IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.indexHistory(); err != nil {
+		return nil, err
+	}
+
+	s.pks = make(chan network.Packet, DispatchQueueSize)
+	s.tasks = make(chan func())
+	s.errs = make(chan error)
+	s.frags = network.NewReassembler(network.FragmentTimeout)
+
+	return s, nil
+}
+
+// SetLogger replaces the Logger of the server, which defaults to text entries
+// of at least logger.Info printed to the standard output. Entries being
+// written with the previous Logger are done once it returns.
+func (s *serv) SetLogger(l logger.Logger) {
+	s.logLock.Lock()
+	s.logger = l
+	s.logLock.Unlock()
 }
 
-func (s *serv) head() string {
-	return "[" + colors.Red(bold, network.GetTimeStamp()) + "][" + colors.Purple(none, s.name) + "]"
+func (s *serv) log(level logger.Level, msg string, fields logger.Fields) {
+	s.logLock.RLock()
+	defer s.logLock.RUnlock()
+	s.logger.Log(level, msg, fields)
 }
 
-func (s *serv) Log(a ...interface{}) {
-	fmt.Print(a...)
+func (s *serv) info(msg string, fields logger.Fields) {
+	s.log(logger.Info, msg, fields)
 }
 
-func (s *serv) Logln(a ...interface{}) {
-	print(s.head(), " ")
-	fmt.Println(a...)
+func (s *serv) warn(msg string, fields logger.Fields) {
+	s.log(logger.Warn, msg, fields)
 }
 
-func (s *serv) Error(a ...interface{}) {
-	print(s.head(), " ")
-	fmt.Println(colors.Red(bold, a...))
+func (s *serv) fail(msg string, err error, fields logger.Fields) {
+	if fields == nil {
+		fields = logger.Fields{}
+	}
+	fields["error"] = err
+	s.log(logger.Error, msg, fields)
+}
+
+// do runs f on the dispatch goroutine and waits for it. Settings only change
+// there (see Reload), so f reads them safely.
+func (s *serv) do(f func()) {
+	done := make(chan struct{})
+	s.tasks <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// clientFields returns the log context of a client
+func clientFields(c *server.Client) logger.Fields {
+	_, addr := c.Address()
+	return logger.Fields{"client": c.ID(), "name": c.Name(), "address": addr}
+}
+
+// packetFields returns the log context of a packet received from conn
+func packetFields(conn net.Conn, p network.Packet) logger.Fields {
+	fields := logger.Fields{"ip": conn.RemoteAddr().String()}
+	if p != nil {
+		fields["head"] = string(p.Header())
+	}
+	return fields
 }
 
 // Start is the serv's main loop and starts its own goroutine
 func (s *serv) Start() {
 	s.running = true
 
-	sem := make(chan byte)
+	listeners, err := s.listen()
+	if err != nil {
+		s.fail("couldn't listen", err, nil)
+		os.Exit(1)
+	}
 
-	go func() {
-		// Start listening
-		s.listen()
-		sem <- 0
-	}()
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l net.Listener) {
+			s.accept(l)
+			wg.Done()
+		}(l)
+	}
+	s.info("server started", logger.Fields{"channel": s.name})
+
+	if MetricsAddress != "" {
+		go s.serveMetrics()
+	}
+
+	if WebSocketAddress != "" {
+		go s.serveWebSocket()
+	}
+
+	if IRCAddress != "" {
+		go s.serveIRC()
+	}
+
+	s.loadPlugins()
+	go s.watchIdle()
+	go s.pruneFragments()
+	go s.reloadOnHangup()
+	if logger.IsTerminal(os.Stdin) {
+		go s.console(os.Stdin, os.Stdout)
+	}
 
 	go func() {
 		for {
-			p := <-s.pks
+			var p network.Packet
+			select {
+			case f := <-s.tasks:
+				f()
+				continue
+			case p = <-s.pks:
+			}
+
+			start := time.Now()
 			// Dispatch work
-			switch p.(type) {
-			case *network.MessagePacket:
-				_ = p.(*network.MessagePacket)
-			case *network.ConnectionPacket:
-				_ = p.(*network.ConnectionPacket)
+			switch p.Header() {
+			case network.LeaveHead:
+				s.disconnect(uuid.UUID(p.Content()), "leave")
+			case network.MessageHead:
+				s.message(p)
+			case network.WhisperHead:
+				s.whisper(p)
+			case network.KeyHead:
+				s.key(p)
+			case network.OfferHead:
+				s.offer(p)
+			case network.AcceptHead:
+				s.answer(p)
+			case network.ChunkHead:
+				s.chunk(p)
+			case network.CommandHead:
+				s.command(p)
+			case network.PresenceHead:
+				s.presence(p)
+			case network.TypingHead:
+				s.typing(p)
+			case network.ReplyHead:
+				s.replyMessage(p)
+			case network.ReactionHead:
+				s.react(p)
+			case network.EditHead:
+				s.edit(p)
+			case network.DeleteHead:
+				s.delete(p)
+			case network.ReadHead:
+				s.read(p)
 			default:
 				continue
 			}
+			s.metrics.dispatch(time.Since(start))
+		}
+	}()
+
+	go func() {
+		for err := range s.errs {
+			s.metrics.sendError(err)
+			s.warn("couldn't reach client", logger.Fields{"error": err})
 		}
 	}()
 
-	<-sem
+	wg.Wait()
 }
 
-func (s *serv) listen() {
-	var (
-		conn net.Conn
-		data []byte
-		err  error
-	)
+// pruneFragments drops the packets the fragments of which stopped coming
+func (s *serv) pruneFragments() {
+	for range time.Tick(network.FragmentTimeout) {
+		s.frags.Prune()
+	}
+}
+
+func (s *serv) emmit(conn net.Conn, data []byte) {
+	if network.IsFragment(data) {
+		// only joined clients send large packets, each one has its own
+		// partial packets
+		owner := network.FragmentOwner(data)
+		if _, ok := s.clients.Get(uuid.UUID(owner)); !ok {
+			s.warn("dropped fragment", logger.Fields{"ip": conn.RemoteAddr().String(), "error": "unknown client"})
+			return
+		}
 
-	address := format("%s:%d", s.ip, s.port)
+		var err error
+		data, err = s.frags.Add(network.Sender(conn.RemoteAddr())+" "+owner, data)
+		if err != nil {
+			s.warn("dropped fragment", logger.Fields{"ip": conn.RemoteAddr().String(), "error": err})
+			return
+		}
 
-	l, err := net.Listen("tcp", address)
+		if data == nil {
+			// packet isn't complete yet
+			return
+		}
+	}
+
+	p, err := network.Parse(data)
 	if err != nil {
-		s.Logln("couldn't listen on", address)
-		os.Exit(1)
+		s.warn("dropped packet", logger.Fields{"ip": conn.RemoteAddr().String(), "error": err})
+		return
 	}
-	defer l.Close()
+	s.metrics.received(p.Header())
+
+	if p.Header() == network.JoinHead {
+		// registering requires the client's address
+		s.join(conn, p)
+		return
+	}
+	s.pks <- p
+}
 
-	s.Logln("Server started on", colors.Green(bold, address))
-	for {
-		if conn != nil {
-			// close previous connection if need be
-			conn.Close()
+// replyAddr returns the network and the address a client joining through
+// conn listens at. TCP clients listen at the address they connect from, Unix
+// socket clients announce their own socket with the listen capability.
+func replyAddr(conn net.Conn, capabilities []string) (string, string, error) {
+	if conn.LocalAddr().Network() == "unix" {
+		for _, capability := range capabilities {
+			if strings.HasPrefix(capability, network.ListenCapability) {
+				return "unix", capability[len(network.ListenCapability):], nil
+			}
 		}
+		return "", "", errors.New("unix socket client didn't announce its socket")
+	}
+
+	host, port, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return "", "", err
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
 
-		data = make([]byte, network.MaxPacketSize)
-		conn, err = l.Accept()
+func (s *serv) join(conn net.Conn, p network.Packet) {
+	// Content : NAME [CAPABILITIES...]
+	fields := strings.Split(p.Content(), " ")
+	name := fields[0]
+
+	netw, addr, err := replyAddr(conn, fields[1:])
+	if err != nil {
+		s.fail("invalid client address", err, packetFields(conn, p))
+		return
+	}
+
+	if netw == "unix" {
+		login, err := unixUser(conn, addr)
 		if err != nil {
-			s.Logln(err)
-			continue
+			s.fail("couldn't authenticate client", err, packetFields(conn, p))
+			return
 		}
+		if login != name {
+			s.info("client renamed after its login", logger.Fields{"name": name, "login": login})
+			name = login
+		}
+	}
 
-		n, err := conn.Read(data)
+	s.register(server.NewClient(uuid.NextUUID(), name, netw, addr), fields[1:])
+}
 
-		if err != nil {
-			s.Logln("couldn't read packet")
-			s.Logln(err)
-			continue
+// register adds c to the clients of the server and welcomes it, negotiating
+// the capabilities it announced. It fails if the name of c is invalid or
+// already taken. Names are valid IRC nicknames, whatever the transport, as
+// they end up in the prefixes of the IRC bridge.
+// Clients register on the dispatch goroutine, as joining reads settings.
+func (s *serv) register(c *server.Client, capabilities []string) bool {
+	ok := false
+	s.do(func() { ok = s.registerClient(c, capabilities) })
+	return ok
+}
+
+func (s *serv) registerClient(c *server.Client, capabilities []string) bool {
+	if netw, _ := c.Address(); netw == "unix" {
+		c.SetOperator(isOperator(c.Name()))
+	}
+
+	if !irc.ValidNick(c.Name()) {
+		s.reply(c, network.PermissionErrorCode, "invalid username "+c.Name())
+		return false
+	}
+
+	if _, taken := s.clients.Named(c.Name()); taken {
+		s.reply(c, network.PermissionErrorCode, "username "+c.Name()+" is already taken")
+		return false
+	}
+
+	if err := s.admit(c, capabilities); err != nil {
+		s.reply(c, network.PermissionErrorCode, err.Error())
+		return false
+	}
+
+	content := string(c.ID())
+	for _, capability := range capabilities {
+		if capability == network.Deflate && AllowCompression {
+			c.SetCompressed(true)
+			content += " " + network.Deflate
 		}
+	}
 
-		s.emmit(conn, data[:n])
+	c.Touch()
+	s.clients.Set(c.ID(), c)
+	s.info("user joined", clientFields(c))
+	s.hooks.Join(c.Name())
+
+	r, err := network.UserPacket(network.JoinHead, c.ID(), content)
+	if err != nil {
+		s.fail("couldn't welcome client", err, clientFields(c))
+		return true
 	}
+	s.send(c, r)
+
+	s.members(c)
+	s.setStatus(c, network.Online, "")
+	s.welcome(c)
+	s.unreadMentions(c)
+	s.readMarker(c)
+	return true
 }
 
-func (s *serv) emmit(conn net.Conn, data []byte) {
-	println(string(data))
-	p, err := network.Compile(conn, []byte("\\C\\"+network.GetTimeStamp().String()+"\\"+string(uuid.NextUUID())+"\\yolo\\hey\\put in your path \\usr\\bin\\"))
+// sender splits the content of a Packet issued by a client in n fields, the
+// first one being the client's ID
+func (s *serv) sender(p network.Packet, n int) (*server.Client, []string, bool) {
+	fields := strings.SplitN(p.Content(), " ", n)
+	if len(fields) != n {
+		return nil, nil, false
+	}
+
+	c, ok := s.clients.Get(uuid.UUID(fields[0]))
+	if ok {
+		s.active(c)
+	}
+	return c, fields[1:], ok
+}
+
+func (s *serv) reply(c *server.Client, code byte, content string) {
+	p, err := network.ServerPacket(code, content)
 	if err != nil {
-		panic(err)
+		s.fail("couldn't reply to client", err, clientFields(c))
+		return
 	}
-	s.pks <- p
+	s.send(c, p)
 }
 
-func (s *serv) sendAll(h network.PacketHeader, content string) {}
+func (s *serv) sendAll(p network.Packet) {
+	for c := range s.clients.Iter() {
+		s.send(c, p)
+	}
+}
 
-func (s *serv) send(c *server.Client, h network.PacketHeader, context string) {}
+func (s *serv) send(c *server.Client, p network.Packet) {
+	var frames [][]byte
+	var err error
+	if c.Streamed() {
+		// streams carry whole packets
+		frames = [][]byte{[]byte(p.String())}
+	} else {
+		frames, err = network.Frames(p, c.Compressed())
+	}
+	if err != nil {
+		fields := clientFields(c)
+		fields["head"] = string(p.Header())
+		s.fail("couldn't send packet", err, fields)
+		return
+	}
 
-func (s *serv) disconnect(id uuid.UUID, reason string) {
+	n := 0
+	for _, f := range frames {
+		c.Send(s.errs, f)
+		n += len(f)
+	}
+	s.metrics.sent(p.Header(), n)
+}
 
+func (s *serv) disconnect(id uuid.UUID, reason string) {
+	if c, ok := s.clients.Get(id); ok {
+		s.disconnectClient(c, reason)
+	}
 }
 
 func (s *serv) disconnectClient(c *server.Client, reason string) {
+	if _, ok := s.clients.Get(c.ID()); !ok {
+		return
+	}
 
+	s.clients.Remove(c.ID())
+	c.Close()
+	s.transfers.drop(c)
+	fields := clientFields(c)
+	fields["reason"] = reason
+	s.info("user left", fields)
+	s.hooks.Leave(c.Name())
+	s.announce(c.Name(), network.Offline, "")
 }
 
 func (s *serv) Quit() {
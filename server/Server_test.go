@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+// newTestServer creates a server keeping everything in memory. The storage
+// paths it clears are restored once the test is done.
+func newTestServer(t *testing.T) *serv {
+	paths := []*string{&HistoryPath, &ChannelsPath, &ReadPath, &IndexPath}
+	saved := make([]string, len(paths))
+	for i, path := range paths {
+		saved[i], *path = *path, ""
+	}
+	t.Cleanup(func() {
+		for i, path := range paths {
+			*path = saved[i]
+		}
+	})
+
+	s, err := newServer("ChatRoom", []string{"127.0.0.1"}, 8081)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
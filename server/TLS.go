@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// TLSCert is the editable path of the PEM certificate the WebSocket gateway
+// and the IRC bridge are served with, along with TLSKey. They are served in
+// plain text if both are empty. Packets of gochat clients aren't encrypted,
+// the server dials them back for every packet.
+// Default value = ""
+var TLSCert = ""
+
+// TLSKey is the editable path of the PEM private key of TLSCert
+// Default value = ""
+var TLSKey = ""
+
+// tlsConfig returns the TLS configuration of the gateways, nil if they are
+// served in plain text
+func tlsConfig(cert, key string) (*tls.Config, error) {
+	if cert == "" && key == "" {
+		return nil, nil
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{pair}}, nil
+}
+
+// listenGateway listens at the address of a gateway, using TLS if a
+// certificate is set
+func listenGateway(addr string) (net.Listener, error) {
+	config, err := tlsConfig(TLSCert, TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	return l, nil
+}
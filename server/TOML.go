@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseTOML reads the subset of TOML used by configuration files : comments,
+// [sections], and key = value pairs where value is a string, an integer, a
+// boolean or an array of those. Keys are returned as section.key, arrays are
+// joined with commas.
+func parseTOML(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	section := ""
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+
+		// arrays may span several lines
+		for strings.Count(text, "[") > strings.Count(text, "]") && strings.Contains(text, "=") && scanner.Scan() {
+			line++
+			text += " " + strings.TrimSpace(stripComment(scanner.Text()))
+		}
+
+		fail := func(msg string) error {
+			return errors.New("line " + strconv.Itoa(line) + " : " + msg)
+		}
+
+		switch {
+		case text == "":
+			continue
+		case text[0] == '[':
+			if text[len(text)-1] != ']' {
+				return nil, fail("unterminated section")
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			if section == "" {
+				return nil, fail("empty section name")
+			}
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			return nil, fail("expected key = value")
+		}
+
+		key := strings.TrimSpace(text[:eq])
+		if key == "" {
+			return nil, fail("empty key")
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+
+		if _, ok := values[key]; ok {
+			return nil, fail("duplicate key " + key)
+		}
+
+		value, err := parseTOMLValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return nil, fail(key + " : " + err.Error())
+		}
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// stripComment removes a trailing # comment outside of strings
+func stripComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func parseTOMLValue(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", errors.New("missing value")
+	case s[0] == '"':
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", errors.New("unterminated string")
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return "", errors.New("unterminated array")
+		}
+		items, err := splitTOMLArray(s[1 : len(s)-1])
+		if err != nil {
+			return "", err
+		}
+		for i, item := range items {
+			if items[i], err = parseTOMLValue(item); err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(items, ","), nil
+	case s == "true" || s == "false":
+		return s, nil
+	default:
+		if _, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 0, 64); err != nil {
+			return "", errors.New("invalid value " + s)
+		}
+		return strings.Replace(s, "_", "", -1), nil
+	}
+}
+
+// splitTOMLArray splits the items of an array on commas outside of strings
+func splitTOMLArray(s string) ([]string, error) {
+	var items []string
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated string")
+	}
+
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items, nil
+}
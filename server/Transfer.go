@@ -0,0 +1,179 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/client"
+	"github.com/Spriithy/gochat-term/server/logger"
+)
+
+// MaxTransferSize is the editable maximum size of a file relayed by the server
+// Default value = 16 MiB
+var MaxTransferSize int64 = 16 << 20
+
+// transfer is a file transfer relayed between two clients
+type transfer struct {
+	id       string
+	from, to *server.Client
+	size     int64
+	relayed  int64
+	accepted bool
+}
+
+func (t *transfer) fields() logger.Fields {
+	return logger.Fields{"transfer": t.id, "from": t.from.Name(), "to": t.to.Name(), "size": t.size}
+}
+
+type transferMap struct {
+	sync.Mutex
+	items map[string]*transfer
+}
+
+func newTransferMap() *transferMap {
+	return &transferMap{sync.Mutex{}, make(map[string]*transfer)}
+}
+
+func (m *transferMap) get(id string) (*transfer, bool) {
+	m.Lock()
+	defer m.Unlock()
+	t, ok := m.items[id]
+	return t, ok
+}
+
+// add registers t unless a transfer with the same id already exists
+func (m *transferMap) add(t *transfer) bool {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.items[t.id]; ok {
+		return false
+	}
+	m.items[t.id] = t
+	return true
+}
+
+func (m *transferMap) remove(id string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.items, id)
+}
+
+// drop cancels every transfer involving c
+func (m *transferMap) drop(c *server.Client) {
+	m.Lock()
+	defer m.Unlock()
+	for id, t := range m.items {
+		if t.from == c || t.to == c {
+			delete(m.items, id)
+		}
+	}
+}
+
+// offer relays a file transfer offer to its recipient
+// Content : ID to FILEID SIZE SHA256 NAME
+func (s *serv) offer(p network.Packet) {
+	from, fields, ok := s.sender(p, 6)
+	if !ok {
+		return
+	}
+
+	to, ok := s.clients.Named(fields[0])
+	if !ok {
+		s.reply(from, network.RequestErrorCode, "unknown user "+fields[0])
+		return
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || size < 0 {
+		s.reply(from, network.RequestErrorCode, "invalid file size")
+		return
+	}
+
+	if size > MaxTransferSize {
+		s.reply(from, network.RequestErrorCode, format("file exceeds the %d bytes transfer limit", MaxTransferSize))
+		return
+	}
+
+	t := &transfer{id: fields[1], from: from, to: to, size: size}
+	if !s.transfers.add(t) {
+		s.reply(from, network.RequestErrorCode, "duplicate transfer id "+t.id)
+		return
+	}
+
+	r, err := network.UserPacket(network.OfferHead, "", from.Name()+" "+t.id+" "+fields[2]+" "+fields[3]+" "+fields[4])
+	if err != nil {
+		s.transfers.remove(t.id)
+		s.fail("couldn't relay file offer", err, clientFields(from))
+		return
+	}
+
+	s.info("file offered", t.fields())
+	s.send(to, r)
+}
+
+// answer relays the recipient's answer to a file transfer offer
+// Content : ID FILEID yes|no
+func (s *serv) answer(p network.Packet) {
+	c, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	t, ok := s.transfers.get(fields[0])
+	if !ok || t.to != c || t.accepted {
+		s.reply(c, network.RequestErrorCode, "no pending transfer "+fields[0])
+		return
+	}
+
+	accepted := fields[1] == "yes"
+	if accepted && t.size > 0 {
+		t.accepted = true
+	} else {
+		s.transfers.remove(t.id)
+	}
+
+	r, err := network.UserPacket(network.AcceptHead, "", c.Name()+" "+t.id+" "+fields[1])
+	if err != nil {
+		s.fail("couldn't relay file offer answer", err, t.fields())
+		return
+	}
+	s.send(t.from, r)
+}
+
+// chunk relays a slice of an accepted file transfer to its recipient
+// Content : ID FILEID OFFSET DATA
+func (s *serv) chunk(p network.Packet) {
+	c, fields, ok := s.sender(p, 4)
+	if !ok {
+		return
+	}
+
+	t, ok := s.transfers.get(fields[0])
+	if !ok || t.from != c || !t.accepted {
+		s.reply(c, network.RequestErrorCode, "no accepted transfer "+fields[0])
+		return
+	}
+
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	n := int64(len(fields[2]))
+	t.relayed += n
+	if err != nil || offset < 0 || offset+n > t.size || t.relayed > t.size {
+		s.transfers.remove(t.id)
+		s.reply(c, network.RequestErrorCode, "transfer "+t.id+" exceeds its announced size")
+		s.reply(t.to, network.RequestErrorCode, "transfer "+t.id+" was cancelled")
+		return
+	}
+
+	r, err := network.UserPacket(network.ChunkHead, "", t.id+" "+fields[1]+" "+fields[2])
+	if err != nil {
+		s.fail("couldn't relay file chunk", err, t.fields())
+		return
+	}
+	s.send(t.to, r)
+
+	if t.relayed == t.size {
+		s.transfers.remove(t.id)
+		s.info("file transfer complete", t.fields())
+	}
+}
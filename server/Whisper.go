@@ -0,0 +1,74 @@
+package server
+
+import (
+	"github.com/Spriithy/gochat-term/network"
+	"github.com/Spriithy/gochat-term/server/plugin"
+)
+
+// whisper relays a private message to its recipient. Sealed messages are
+// relayed as is, the server cannot read them.
+// Content : ID to MESSAGE
+func (s *serv) whisper(p network.Packet) {
+	from, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	to, ok := s.clients.Named(fields[0])
+	if !ok {
+		s.reply(from, network.RequestErrorCode, "unknown user "+fields[0])
+		return
+	}
+
+	w := &plugin.Whisper{From: from.Name(), To: to.Name(), Text: fields[1]}
+	if !s.hooks.Whisper(w) {
+		s.reply(from, network.PermissionErrorCode, "whisper was rejected")
+		return
+	}
+
+	r, err := network.UserPacket(network.WhisperHead, "", from.Name()+" "+fields[1])
+	if err != nil {
+		s.fail("couldn't relay whisper", err, clientFields(from))
+		return
+	}
+	s.send(to, r)
+	s.autoReply(from, to)
+}
+
+// key publishes a client's public key or looks up another user's one
+// Content : ID publish KEY
+//           ID lookup NAME
+func (s *serv) key(p network.Packet) {
+	c, fields, ok := s.sender(p, 3)
+	if !ok {
+		return
+	}
+
+	switch fields[0] {
+	case "publish":
+		if err := network.CheckPublicKey(fields[1]); err != nil {
+			s.reply(c, network.RequestErrorCode, err.Error())
+			return
+		}
+
+		if c.Key() != "" && c.Key() != fields[1] {
+			s.info("user changed its public key", clientFields(c))
+		}
+		c.SetKey(fields[1])
+	case "lookup":
+		target, ok := s.clients.Named(fields[1])
+		if !ok || target.Key() == "" {
+			s.reply(c, network.RequestErrorCode, "no public key for "+fields[1])
+			return
+		}
+
+		r, err := network.UserPacket(network.KeyHead, "", target.Name()+" "+target.Key())
+		if err != nil {
+			s.fail("couldn't answer key lookup", err, clientFields(c))
+			return
+		}
+		s.send(c, r)
+	default:
+		s.reply(c, network.RequestErrorCode, "unknown key request "+fields[0])
+	}
+}
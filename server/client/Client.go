@@ -2,7 +2,10 @@ package server
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"sync"
 	"time"
 
 	"errors"
@@ -29,49 +32,280 @@ var ErrClientUnreachable = errors.New("client is unreachable")
 // ErrClientUnavailable notifies the caller that the server cannot send data to the client
 var ErrClientUnavailable = errors.New("client is unavailable")
 
+// StreamQueueSize is the amount of packets waiting to be written to a stream
+// client. A client falling further behind is disconnected.
+const StreamQueueSize = 256
+
+// ErrClientTooSlow notifies the caller that a stream client didn't read the
+// packets sent to it, and was disconnected
+var ErrClientTooSlow = errors.New("client is too slow")
+
 // Client is the representation of the actual Server's client
 //
 type Client struct {
 	id   uuid.UUID
 	name string
-	ip   string
-	port int
 
-	attempts int
+	// network and address the Client listens at, as given to net.Dial
+	network string
+	addr    string
+
+	// stream carries the packets of clients holding a connection open, such
+	// as WebSocket clients, instead of dialing them. They are written by
+	// their own goroutine from queue, until done is closed. stopped is closed
+	// once the goroutine returned.
+	stream  io.Writer
+	queue   chan outgoing
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	compress bool
+
+	// key is the public key used to seal whispers to the Client
+	key string
+
+	// presence and rights of the Client, guarded by mu
+	mu       sync.Mutex
+	status   string
+	note     string
+	active   time.Time
+	typed    time.Time
+	operator bool
+}
+
+// outgoing is a packet waiting to be written to a stream client
+type outgoing struct {
+	data   []byte
+	errors chan error
 }
 
 // NewServerClient creates a new instance of a Client using its ConnectionPacket
 func NewServerClient(p *network.ConnectionPacket) *Client {
 	ip, port := p.From()
 	return &Client{
-		id:       p.UserID(),
-		name:     p.UserName(),
-		ip:       ip,
-		port:     port,
-		attempts: 0}
+		id:      p.UserID(),
+		name:    p.UserName(),
+		network: "tcp",
+		addr:    net.JoinHostPort(ip, strconv.Itoa(port))}
+}
+
+// NewClient creates a new instance of a Client listening at the given
+// address, network being either tcp or unix
+func NewClient(id uuid.UUID, name, network, addr string) *Client {
+	return &Client{
+		id:      id,
+		name:    name,
+		network: network,
+		addr:    addr}
+}
+
+// NewStreamClient creates a new instance of a Client which packets are
+// written to w, addr being the address of its connection
+func NewStreamClient(id uuid.UUID, name, network, addr string, w io.Writer) *Client {
+	c := &Client{
+		id:      id,
+		name:    name,
+		network: network,
+		addr:    addr,
+		stream:  w,
+		queue:   make(chan outgoing, StreamQueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{})}
+	go c.write()
+	return c
+}
+
+// write writes the packets queued for a stream client, in order, until it
+// is closed. The packets queued before are still written.
+func (c *Client) write() {
+	defer close(c.stopped)
+	for {
+		select {
+		case o := <-c.queue:
+			if !c.writeQueued(o) {
+				return
+			}
+		case <-c.done:
+			for {
+				select {
+				case o := <-c.queue:
+					if !c.writeQueued(o) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) writeQueued(o outgoing) bool {
+	if _, err := c.stream.Write(o.data); err != nil {
+		go func() { o.errors <- ErrClientUnavailable }()
+		c.hangUp()
+		return false
+	}
+	return true
+}
+
+// hangUp closes the connection of a stream client, which then leaves
+func (c *Client) hangUp() {
+	if closer, ok := c.stream.(io.Closer); ok {
+		closer.Close()
+	}
+	c.Close()
+}
+
+// Close stops writing to a stream client once the packets already sent are
+// written, which Flush waits for
+func (c *Client) Close() {
+	if c.stream != nil {
+		c.once.Do(func() { close(c.done) })
+	}
+}
+
+// Flush closes a stream client and waits for the packets sent to it to be
+// written, before its connection is closed
+func (c *Client) Flush() {
+	if c.stream != nil {
+		c.Close()
+		<-c.stopped
+	}
+}
+
+// ID returns the unique identifier of the Client
+func (c *Client) ID() uuid.UUID {
+	return c.id
+}
+
+// Address returns the network and the address the Client listens at
+func (c *Client) Address() (string, string) {
+	return c.network, c.addr
+}
+
+// Name returns the username of the Client
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Compressed tells whether the Client negotiated compressed packets
+func (c *Client) Compressed() bool {
+	return c.compress
+}
+
+// SetCompressed sets whether packets sent to the Client are compressed
+func (c *Client) SetCompressed(b bool) {
+	c.compress = b
+}
+
+// Key returns the public key published by the Client
+func (c *Client) Key() string {
+	return c.key
+}
+
+// SetKey sets the public key published by the Client
+func (c *Client) SetKey(key string) {
+	c.key = key
+}
+
+// Status returns the presence status of the Client and its note
+func (c *Client) Status() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status, c.note
+}
+
+// SetStatus sets the presence status of the Client and its note
+func (c *Client) SetStatus(status, note string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status, c.note = status, note
+}
+
+// Touch records activity of the Client
+func (c *Client) Touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = time.Now()
+}
+
+// Typing records that the Client is typing, unless it was already shown
+// typing less than interval ago. It tells whether the Client is shown typing.
+func (c *Client) Typing(interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.typed) < interval {
+		return false
+	}
+	c.typed = now
+	return true
+}
+
+// Active returns the time of the last activity of the Client
+func (c *Client) Active() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// Operator tells whether the Client may moderate the messages of others
+func (c *Client) Operator() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.operator
+}
+
+// SetOperator sets whether the Client is an operator
+func (c *Client) SetOperator(b bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.operator = b
+}
+
+// Streamed tells whether the Client holds a connection packets are written to
+func (c *Client) Streamed() bool {
+	return c.stream != nil
 }
 
 // Send attempts to sending data to the Client
 // If it fails in the first place, it tries up to
 func (c *Client) Send(errors chan error, data []byte) {
+	if c.stream != nil {
+		// the queue keeps the order of packets on the connection, without
+		// waiting for slow peers
+		select {
+		case <-c.done:
+		case c.queue <- outgoing{data, errors}:
+		default:
+			go func() { errors <- ErrClientTooSlow }()
+			c.hangUp()
+		}
+		return
+	}
+
+	// each packet has its own attempts, sent concurrently
 	go func() {
-		addr := format("%s:%d", c.ip, c.port)
-		conn, err := net.Dial("tcp", addr)
+		attempts := 0
+		conn, err := net.Dial(c.network, c.addr)
 		if conn != nil {
 			defer conn.Close()
 		}
 
 	outside:
 		for {
-			if c.attempts >= MaxSendAttempts {
+			if attempts >= MaxSendAttempts {
 				errors <- ErrClientTimeout
 				return
 			}
 
 			if err != nil {
 				errors <- ErrClientUnreachable
-				c.attempts++
-				conn, err = net.Dial("tcp", addr)
+				attempts++
+				conn, err = net.Dial(c.network, c.addr)
 				if err != nil {
 					errors <- err
 				}
@@ -79,7 +313,7 @@ func (c *Client) Send(errors chan error, data []byte) {
 				continue outside
 			}
 
-			if c.attempts > 0 {
+			if attempts > 0 {
 				// if first attempt failed, then conn would have never been closed
 				defer conn.Close()
 			}
@@ -88,12 +322,11 @@ func (c *Client) Send(errors chan error, data []byte) {
 
 			if err != nil {
 				errors <- ErrClientUnavailable
-				c.attempts++
+				attempts++
 				time.Sleep(time.Second)
 				continue outside
 			}
 			return
 		}
 	}()
-	c.attempts = 0
 }
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockedWriter is a peer that doesn't read until it is released
+type blockedWriter struct {
+	sync.Mutex
+	release chan struct{}
+	closed  chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockedWriter) Write(data []byte) (int, error) {
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.Write(data)
+}
+
+func (w *blockedWriter) Close() error {
+	close(w.closed)
+	return nil
+}
+
+func TestStreamQueue(t *testing.T) {
+	w := &blockedWriter{release: make(chan struct{}), closed: make(chan struct{})}
+	c := NewStreamClient("id", "joncena", "websocket", "127.0.0.1:1", w)
+	errs := make(chan error, 1)
+
+	// sending never waits for the peer, which is hung up on once the queue
+	// is full
+	for i := 0; i <= StreamQueueSize+1; i++ {
+		c.Send(errs, []byte("M"))
+	}
+	<-w.closed
+	if err := <-errs; err != ErrClientTooSlow {
+		t.Errorf("expected ErrClientTooSlow, got %v", err)
+	}
+
+	close(w.release)
+	c.Flush()
+	w.Lock()
+	defer w.Unlock()
+	if n := w.buf.Len(); n < StreamQueueSize {
+		t.Errorf("queued packets weren't written : %d", n)
+	}
+}
+
+func TestTyping(t *testing.T) {
+	c := NewClient("id", "joncena", "tcp", "127.0.0.1:1")
+	if !c.Typing(time.Minute) {
+		t.Error("the first typing packet should be relayed")
+	}
+	if c.Typing(time.Minute) {
+		t.Error("typing packets should be relayed once per interval")
+	}
+	if !c.Typing(0) {
+		t.Error("typing packets should be relayed once the interval is over")
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/Spriithy/go-uuid"
+)
+
+// ClientMap is a registry of Clients safe for concurrent use
+//
+type ClientMap struct {
+	sync.RWMutex
+	items map[uuid.UUID]*Client
+}
+
+// NewClientMap creates an empty ClientMap
+func NewClientMap() *ClientMap {
+	return &ClientMap{sync.RWMutex{}, make(map[uuid.UUID]*Client)}
+}
+
+// Size returns the amount of registered Clients
+func (m *ClientMap) Size() int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.items)
+}
+
+// Get returns the Client registered under id
+func (m *ClientMap) Get(id uuid.UUID) (*Client, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	value, ok := m.items[id]
+	return value, ok
+}
+
+// Named returns the Client registered with the given username
+func (m *ClientMap) Named(name string) (*Client, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	for _, c := range m.items {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Set registers a Client under id
+func (m *ClientMap) Set(id uuid.UUID, c *Client) {
+	m.Lock()
+	defer m.Unlock()
+	m.items[id] = c
+}
+
+// Remove unregisters the Client with the given id
+func (m *ClientMap) Remove(id uuid.UUID) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.items, id)
+}
+
+// Iter returns a channel over a snapshot of the registered Clients
+func (m *ClientMap) Iter() <-chan *Client {
+	m.RLock()
+	items := make([]*Client, 0, len(m.items))
+	for _, v := range m.items {
+		items = append(items, v)
+	}
+	m.RUnlock()
+
+	c := make(chan *Client)
+	go func() {
+		for _, v := range items {
+			c <- v
+		}
+		close(c)
+	}()
+
+	return c
+}
@@ -0,0 +1,124 @@
+// Package irc reads and writes the messages of the IRC client protocol
+// (RFC 2812) understood by the gochat bridge
+package irc
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxLineSize is the maximum size of an IRC line, CRLF included
+const MaxLineSize = 512
+
+// Numeric replies sent by the bridge
+const (
+	RplWelcome       = "001"
+	RplEndOfWho      = "315"
+	RplList          = "322"
+	RplListEnd       = "323"
+	RplNoTopic       = "331"
+	RplTopic         = "332"
+	RplTopicWhoTime  = "333"
+	RplNamReply      = "353"
+	RplEndOfNames    = "366"
+	ErrNoSuchNick    = "401"
+	ErrNoSuchChannel = "403"
+	ErrUnknownCmd    = "421"
+	ErrNoNickname    = "431"
+	ErrErroneusNick  = "432"
+	ErrNicknameInUse = "433"
+	ErrNotOnChannel  = "442"
+	ErrNotRegistered = "451"
+	ErrNeedMoreParam = "461"
+	ErrChanOPrivs    = "482"
+)
+
+// Message is a line of the IRC protocol
+//
+type Message struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Parse reads a line of the IRC protocol, without its CRLF
+func Parse(line string) (Message, error) {
+	var m Message
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return m, errors.New("missing command")
+		}
+		m.Prefix, line = line[1:i], strings.TrimLeft(line[i:], " ")
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") && m.Command != "" {
+			// trailing parameter, may contain spaces
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+
+		word := line
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			word, line = line[:i], strings.TrimLeft(line[i:], " ")
+		} else {
+			line = ""
+		}
+
+		if m.Command == "" {
+			m.Command = strings.ToUpper(word)
+		} else {
+			m.Params = append(m.Params, word)
+		}
+	}
+
+	if m.Command == "" {
+		return m, errors.New("missing command")
+	}
+	return m, nil
+}
+
+// newlines replaces the line breaks that would end an IRC line early
+var newlines = strings.NewReplacer("\r", " ", "\n", " ")
+
+// Lines splits a text on its line breaks, CRLF, CR or LF, to send each line
+// as its own message
+func Lines(text string) []string {
+	return strings.Split(strings.Replace(strings.Replace(text, "\r\n", "\n", -1), "\r", "\n", -1), "\n")
+}
+
+// String formats m as a line of the IRC protocol, CRLF included. The last
+// parameter is always sent as a trailing one. Line breaks in the prefix and
+// the parameters are replaced by spaces.
+func (m Message) String() string {
+	line := newlines.Replace(m.Command)
+	if m.Prefix != "" {
+		line = ":" + newlines.Replace(m.Prefix) + " " + line
+	}
+
+	for i, p := range m.Params {
+		p = newlines.Replace(p)
+		if i == len(m.Params)-1 {
+			line += " :" + p
+		} else {
+			line += " " + p
+		}
+	}
+
+	if len(line) > MaxLineSize-2 {
+		line = line[:MaxLineSize-2]
+	}
+	return line + "\r\n"
+}
+
+// ValidNick tells whether nick may be used as an IRC nickname, and as a
+// gochat username
+func ValidNick(nick string) bool {
+	if nick == "" || len(nick) > 32 || strings.ContainsAny(nick, " ,*?!@:#&\r\n\t") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		m    Message
+	}{
+		{"NICK alice\r\n", Message{"", "NICK", []string{"alice"}}},
+		{"user alice 0 * :Alice Liddell", Message{"", "USER", []string{"alice", "0", "*", "Alice Liddell"}}},
+		{":bob!bob@host PRIVMSG #room :hello :)", Message{"bob!bob@host", "PRIVMSG", []string{"#room", "hello :)"}}},
+		{"PING  :token", Message{"", "PING", []string{"token"}}},
+		{"QUIT", Message{"", "QUIT", nil}},
+	}
+
+	for _, test := range tests {
+		m, err := Parse(test.line)
+		if err != nil {
+			t.Errorf("%q : %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("%q : got %+v, expected %+v", test.line, m, test.m)
+		}
+	}
+
+	for _, line := range []string{"", ":prefix", ":prefix "} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("%q should be rejected", line)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	m := Message{"gochat", "PRIVMSG", []string{"#room", "hello world"}}
+	if got := m.String(); got != ":gochat PRIVMSG #room :hello world\r\n" {
+		t.Errorf("unexpected line %q", got)
+	}
+
+	m, err := Parse(m.String())
+	if err != nil || m.Params[1] != "hello world" {
+		t.Errorf("round trip failed : %+v %v", m, err)
+	}
+
+	m = Message{"gochat", "NOTICE", []string{"alice", "hello\r\nQUIT :bye\nPING x"}}
+	if got := m.String(); got != ":gochat NOTICE alice :hello  QUIT :bye PING x\r\n" {
+		t.Errorf("line breaks weren't removed : %q", got)
+	}
+}
+
+func TestLines(t *testing.T) {
+	if lines := Lines("one\r\ntwo\rthree\nfour"); !reflect.DeepEqual(lines, []string{"one", "two", "three", "four"}) {
+		t.Errorf("unexpected lines %q", lines)
+	}
+	if lines := Lines(""); !reflect.DeepEqual(lines, []string{""}) {
+		t.Errorf("unexpected lines %q", lines)
+	}
+}
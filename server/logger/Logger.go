@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spriithy/go-colors"
+)
+
+// fmt.Sprintf alias for code readability
+var format = fmt.Sprintf
+
+// Level is the severity of a log entry
+type Level int
+
+// Log levels, in increasing severity
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a Level from its name
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(l), nil
+		}
+	}
+	return Info, errors.New("unknown log level " + s)
+}
+
+// Format is the output format of a Logger
+type Format int
+
+// Output formats
+const (
+	// Text is meant for humans, colored on terminals
+	Text Format = iota
+
+	// Logfmt outputs key=value pairs
+	Logfmt
+
+	// JSON outputs one JSON object per line
+	JSON
+)
+
+// ParseFormat reads a Format from its name (text, logfmt or json)
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return Text, nil
+	case "logfmt":
+		return Logfmt, nil
+	case "json":
+		return JSON, nil
+	default:
+		return Text, errors.New("unknown log format " + s)
+	}
+}
+
+// Fields are the structured context of a log entry, such as the client id,
+// its ip, the packet head or the channel
+type Fields map[string]interface{}
+
+// Logger is the interface of any log backend the server can use
+//
+type Logger interface {
+	// Log records an entry unless its level is below the Logger's one
+	Log(level Level, msg string, fields Fields)
+}
+
+type writer struct {
+	sync.Mutex
+	w      io.Writer
+	format Format
+	level  Level
+	color  bool
+}
+
+// New creates a Logger writing entries of at least the given level to w.
+// Text entries are only colored if w is a terminal.
+func New(w io.Writer, format Format, level Level) Logger {
+	color := false
+	if f, ok := w.(*os.File); ok {
+		color = IsTerminal(f)
+	}
+	return &writer{w: w, format: format, level: level, color: color}
+}
+
+// IsTerminal tells whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func keys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quote quotes logfmt values when they need to
+func quote(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (l *writer) Log(level Level, msg string, fields Fields) {
+	if level < l.level {
+		return
+	}
+
+	t := time.Now()
+	var line string
+	switch l.format {
+	case JSON:
+		entry := make(map[string]interface{}, len(fields)+3)
+		for k, v := range fields {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			entry[k] = v
+		}
+		entry["time"] = t.Format(time.RFC3339)
+		entry["level"] = level.String()
+		entry["msg"] = msg
+
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			raw, _ = json.Marshal(map[string]string{"level": "error", "msg": "unserializable log entry : " + err.Error()})
+		}
+		line = string(raw)
+	case Logfmt:
+		line = "time=" + t.Format(time.RFC3339) + " level=" + level.String() + " msg=" + quote(msg)
+		for _, k := range keys(fields) {
+			line += " " + k + "=" + quote(fields[k])
+		}
+	default:
+		stamp, name := "["+t.Format("15:04:05")+"]", strings.ToUpper(level.String())
+		if l.color {
+			stamp = "[" + colors.Red(colors.Bold, t.Format("15:04:05")) + "]"
+			if level >= Warn {
+				msg = colors.Red(colors.Bold, msg)
+			}
+		}
+		line = stamp + " " + format("%-5s", name) + " " + msg
+		for _, k := range keys(fields) {
+			line += " " + k + "=" + quote(fields[k])
+		}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	io.WriteString(l.w, line+"\n")
+}
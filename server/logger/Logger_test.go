@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, Logfmt, Info)
+	l.Log(Debug, "hidden", nil)
+	l.Log(Warn, "dropped packet", Fields{"ip": "10.0.0.2:5000", "error": errors.New("malformed packet")})
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected a single entry, got %q", line)
+	}
+	if !strings.Contains(line, ` level=warn msg="dropped packet" error="malformed packet" ip=10.0.0.2:5000`) {
+		t.Errorf("unexpected logfmt entry %q", line)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, JSON, Debug).Log(Info, "user joined", Fields{"name": "joncena", "head": "J"})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "info" || entry["msg"] != "user joined" || entry["name"] != "joncena" {
+		t.Errorf("unexpected JSON entry %v", entry)
+	}
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingFile is a log file that is rotated once it grows past a maximum
+// size. Rotated files are suffixed .1 (most recent) up to .N
+//
+type RotatingFile struct {
+	sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending, rotating it past maxSize bytes and
+// keeping up to backups rotated files
+func NewRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// rotate moves the current file to its first backup and reopens a new one. If
+// it cannot be moved, the current file is reopened and keeps growing.
+func (r *RotatingFile) rotate() error {
+	r.file.Close()
+
+	if r.backups > 0 {
+		for i := r.backups - 1; i > 0; i-- {
+			os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1))
+		}
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+
+	return r.open()
+}
+
+// Write appends p to the file, rotating it first if it would grow too large
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file
+func (r *RotatingFile) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// hookSet are the hooks registered by a plugin
+type hookSet struct {
+	join    []JoinHook
+	leave   []LeaveHook
+	message []MessageHook
+	whisper []WhisperHook
+}
+
+// Command is a command registered by a plugin
+//
+type Command struct {
+	Name  string
+	Usage string
+	Owner string
+	run   CommandFunc
+}
+
+// Hooks keeps the hooks and commands of the loaded plugins, and runs them in
+// the order plugins were loaded. A panicking hook is ignored.
+//
+type Hooks struct {
+	sync.RWMutex
+	owners   []string
+	sets     map[string]*hookSet
+	commands map[string]Command
+}
+
+// NewHooks creates an empty set of Hooks
+func NewHooks() *Hooks {
+	return &Hooks{sets: make(map[string]*hookSet), commands: make(map[string]Command)}
+}
+
+// set returns the hooks of owner, the lock being held
+func (h *Hooks) set(owner string) *hookSet {
+	set, ok := h.sets[owner]
+	if !ok {
+		set = new(hookSet)
+		h.sets[owner] = set
+		h.owners = append(h.owners, owner)
+	}
+	return set
+}
+
+// Add makes room for the hooks of owner, it returns false if owner already
+// has hooks
+func (h *Hooks) Add(owner string) bool {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.sets[owner]; ok {
+		return false
+	}
+	h.set(owner)
+	return true
+}
+
+// OnJoin registers a JoinHook of owner
+func (h *Hooks) OnJoin(owner string, f JoinHook) {
+	h.Lock()
+	defer h.Unlock()
+	set := h.set(owner)
+	set.join = append(set.join, f)
+}
+
+// OnLeave registers a LeaveHook of owner
+func (h *Hooks) OnLeave(owner string, f LeaveHook) {
+	h.Lock()
+	defer h.Unlock()
+	set := h.set(owner)
+	set.leave = append(set.leave, f)
+}
+
+// OnMessage registers a MessageHook of owner
+func (h *Hooks) OnMessage(owner string, f MessageHook) {
+	h.Lock()
+	defer h.Unlock()
+	set := h.set(owner)
+	set.message = append(set.message, f)
+}
+
+// OnWhisper registers a WhisperHook of owner
+func (h *Hooks) OnWhisper(owner string, f WhisperHook) {
+	h.Lock()
+	defer h.Unlock()
+	set := h.set(owner)
+	set.whisper = append(set.whisper, f)
+}
+
+// Command registers a command of owner, unless another one has the same name
+func (h *Hooks) Command(owner, name, usage string, f CommandFunc) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if name == "" {
+		return errors.New("empty command name")
+	}
+	if c, ok := h.commands[name]; ok {
+		return errors.New("command " + name + " is already registered by " + c.Owner)
+	}
+	h.set(owner)
+	h.commands[name] = Command{name, usage, owner, f}
+	return nil
+}
+
+// Remove drops every hook and command of owner
+func (h *Hooks) Remove(owner string) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.sets, owner)
+	for i, o := range h.owners {
+		if o == owner {
+			h.owners = append(h.owners[:i], h.owners[i+1:]...)
+			break
+		}
+	}
+	for name, c := range h.commands {
+		if c.Owner == owner {
+			delete(h.commands, name)
+		}
+	}
+}
+
+// each calls f with the hooks of every owner, in order
+func (h *Hooks) each(f func(set *hookSet)) {
+	h.RLock()
+	sets := make([]*hookSet, len(h.owners))
+	for i, owner := range h.owners {
+		sets[i] = h.sets[owner]
+	}
+	h.RUnlock()
+
+	for _, set := range sets {
+		f(set)
+	}
+}
+
+// safely runs a hook, recovering from its panics
+func safely(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin panic : %v", r)
+		}
+	}()
+	f()
+	return nil
+}
+
+// Join runs the join hooks
+func (h *Hooks) Join(user string) {
+	h.each(func(set *hookSet) {
+		for _, f := range set.join {
+			safely(func() { f(user) })
+		}
+	})
+}
+
+// Leave runs the leave hooks
+func (h *Hooks) Leave(user string) {
+	h.each(func(set *hookSet) {
+		for _, f := range set.leave {
+			safely(func() { f(user) })
+		}
+	})
+}
+
+// Message runs the message hooks, it returns false if one of them vetoed m
+func (h *Hooks) Message(m *Message) bool {
+	allowed := true
+	h.each(func(set *hookSet) {
+		for _, f := range set.message {
+			if allowed {
+				safely(func() { allowed = f(m) })
+			}
+		}
+	})
+	return allowed
+}
+
+// Whisper runs the whisper hooks, it returns false if one of them vetoed w
+func (h *Hooks) Whisper(w *Whisper) bool {
+	allowed := true
+	h.each(func(set *hookSet) {
+		for _, f := range set.whisper {
+			if allowed {
+				safely(func() { allowed = f(w) })
+			}
+		}
+	})
+	return allowed
+}
+
+// Run runs the command name issued by user
+func (h *Hooks) Run(user, name string, args []string) (string, error) {
+	h.RLock()
+	c, ok := h.commands[name]
+	h.RUnlock()
+	if !ok {
+		return "", ErrUnknownCommand
+	}
+
+	var answer string
+	var err error
+	if perr := safely(func() { answer, err = c.run(user, args) }); perr != nil {
+		return "", perr
+	}
+	return answer, err
+}
+
+// Commands returns the registered commands, sorted by name
+func (h *Hooks) Commands() []Command {
+	h.RLock()
+	defer h.RUnlock()
+
+	commands := make([]Command, 0, len(h.commands))
+	for _, c := range h.commands {
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageHooks(t *testing.T) {
+	h := NewHooks()
+	h.OnMessage("upper", func(m *Message) bool {
+		m.Text = strings.ToUpper(m.Text)
+		return true
+	})
+	h.OnMessage("censor", func(m *Message) bool {
+		return !strings.Contains(m.Text, "SPAM")
+	})
+	h.OnMessage("broken", func(m *Message) bool {
+		panic("broken plugin")
+	})
+
+	m := &Message{From: "alice", Text: "hello"}
+	if !h.Message(m) || m.Text != "HELLO" {
+		t.Errorf("expected HELLO to go through, got %q", m.Text)
+	}
+
+	if h.Message(&Message{From: "alice", Text: "spam"}) {
+		t.Error("spam should be vetoed")
+	}
+
+	h.Remove("censor")
+	if !h.Message(&Message{From: "alice", Text: "spam"}) {
+		t.Error("removed hooks shouldn't run")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	h := NewHooks()
+	echo := func(user string, args []string) (string, error) {
+		return user + " " + strings.Join(args, " "), nil
+	}
+
+	if err := h.Command("a", "echo", "echo ARGS", echo); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Command("b", "echo", "echo ARGS", echo); err == nil {
+		t.Error("duplicate commands should be refused")
+	}
+
+	if answer, err := h.Run("alice", "echo", []string{"hi"}); err != nil || answer != "alice hi" {
+		t.Errorf("unexpected answer %q %v", answer, err)
+	}
+
+	h.Remove("a")
+	if _, err := h.Run("alice", "echo", nil); err != ErrUnknownCommand {
+		t.Errorf("expected ErrUnknownCommand, got %v", err)
+	}
+}
+
+// host records what a plugin says
+type host struct {
+	*Hooks
+	said chan string
+}
+
+func (h host) OnJoin(f JoinHook)       { h.Hooks.OnJoin("test", f) }
+func (h host) OnLeave(f LeaveHook)     { h.Hooks.OnLeave("test", f) }
+func (h host) OnMessage(f MessageHook) { h.Hooks.OnMessage("test", f) }
+func (h host) OnWhisper(f WhisperHook) { h.Hooks.OnWhisper("test", f) }
+
+func (h host) Command(name, usage string, f CommandFunc) error {
+	return h.Hooks.Command("test", name, usage, f)
+}
+
+func (h host) Every(d time.Duration, f func()) {}
+func (h host) Say(text string)                 { h.said <- text }
+func (h host) Tell(user, text string) error    { return nil }
+
+func TestRemote(t *testing.T) {
+	server, plugin := net.Pipe()
+	defer server.Close()
+	defer plugin.Close()
+
+	// the out-of-process plugin
+	go func() {
+		enc := json.NewEncoder(plugin)
+		enc.Encode(frame{Type: "hello", Name: "shout", Hooks: []string{"join", "message"}})
+
+		scanner := bufio.NewScanner(plugin)
+		for scanner.Scan() {
+			var f frame
+			json.Unmarshal(scanner.Bytes(), &f)
+			switch f.Type {
+			case "join":
+				enc.Encode(frame{Type: "say", Text: "welcome " + f.User})
+			case "message":
+				enc.Encode(frame{Type: "reply", ID: f.ID, Text: f.Text + "!", Veto: f.Text == "no"})
+			}
+		}
+	}()
+
+	r, err := NewRemote(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := host{NewHooks(), make(chan string, 1)}
+	if err := r.Init(h); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Join("alice")
+	if said := <-h.said; said != "welcome alice" {
+		t.Errorf("unexpected message %q", said)
+	}
+
+	m := &Message{From: "alice", Text: "hi"}
+	if !h.Message(m) || m.Text != "hi!" {
+		t.Errorf("expected hi! to go through, got %q", m.Text)
+	}
+
+	if h.Message(&Message{From: "alice", Text: "no"}) {
+		t.Error("message should be vetoed")
+	}
+}
@@ -0,0 +1,112 @@
+// Package plugin lets server-side extensions hook into the gochat server.
+// Plugins are either compiled in and added to the registry with Register,
+// usually from an init function, or run out of process and connect to the
+// server's plugin socket (see Remote.go).
+package plugin
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message is a channel message going through the message hooks, which may
+// change its Text
+//
+type Message struct {
+	From    string
+	Channel string
+	Text    string
+}
+
+// Whisper is a whisper going through the whisper hooks. Its Text may be
+// sealed, in which case hooks can only let it through or veto it.
+//
+type Whisper struct {
+	From string
+	To   string
+	Text string
+}
+
+// JoinHook is called when a user joins the server
+type JoinHook func(user string)
+
+// LeaveHook is called when a user leaves the server
+type LeaveHook func(user string)
+
+// MessageHook is called before a channel message is broadcast. It may change
+// the message, and returns false to veto it.
+type MessageHook func(m *Message) bool
+
+// WhisperHook is called before a whisper is relayed, and returns false to
+// veto it
+type WhisperHook func(w *Whisper) bool
+
+// CommandFunc runs a command issued by user, returning the text answered to
+// the user
+type CommandFunc func(user string, args []string) (string, error)
+
+// Host is the server as seen by a plugin
+//
+type Host interface {
+	OnJoin(JoinHook)
+	OnLeave(LeaveHook)
+	OnMessage(MessageHook)
+	OnWhisper(WhisperHook)
+
+	// Command registers a command users run with /name
+	Command(name, usage string, f CommandFunc) error
+
+	// Every calls f every d until the server stops
+	Every(d time.Duration, f func())
+
+	// Say sends a channel message on behalf of the plugin
+	Say(text string)
+
+	// Tell whispers to a user on behalf of the plugin
+	Tell(user, text string) error
+}
+
+// Plugin is a server-side extension
+//
+type Plugin interface {
+	// Name identifies the plugin, and the messages it sends
+	Name() string
+
+	// Init registers the hooks of the plugin
+	Init(Host) error
+}
+
+var registry = struct {
+	sync.Mutex
+	plugins map[string]Plugin
+}{plugins: make(map[string]Plugin)}
+
+// Register adds a plugin to the ones loaded by the server when it starts. It
+// panics if a plugin with the same name is already registered.
+func Register(p Plugin) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.plugins[p.Name()]; ok {
+		panic("plugin " + p.Name() + " is already registered")
+	}
+	registry.plugins[p.Name()] = p
+}
+
+// Plugins returns the registered plugins, sorted by name
+func Plugins() []Plugin {
+	registry.Lock()
+	defer registry.Unlock()
+
+	plugins := make([]Plugin, 0, len(registry.plugins))
+	for _, p := range registry.plugins {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name() < plugins[j].Name() })
+	return plugins
+}
+
+// ErrUnknownCommand is returned when running a command nobody registered
+var ErrUnknownCommand = errors.New("unknown command")
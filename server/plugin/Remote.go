@@ -0,0 +1,232 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Out-of-process plugins connect to the plugin socket of the server and
+// exchange JSON objects with it, one per line.
+//
+// - The plugin introduces itself first :
+//  	{"type": "hello", "name": "oncall", "hooks": ["join", "message"],
+//  	 "commands": [{"name": "oncall", "usage": "oncall [team]"}]}
+//
+// - The server notifies joins and leaves :
+//  	{"type": "join", "user": "alice"}
+//
+// - The server asks for messages, whispers and commands, and the plugin must
+// answer with the same id within Timeout. Messages and whispers are let
+// through unchanged if it doesn't.
+//  	{"type": "message", "id": 1, "user": "alice", "channel": "ChatRoom", "text": "hi"}
+//  	{"type": "whisper", "id": 2, "user": "alice", "to": "bob", "text": "hi"}
+//  	{"type": "command", "id": 3, "user": "alice", "name": "oncall", "args": ["ops"]}
+//  	{"type": "reply", "id": 1, "text": "hi!", "veto": false, "error": ""}
+//
+// - The plugin may talk at any time :
+//  	{"type": "say", "text": "deploy in 5 minutes"}
+//  	{"type": "tell", "to": "alice", "text": "you are on call"}
+//
+
+// Timeout is the editable time an out-of-process plugin has to reply
+// Default value = 1s
+var Timeout = time.Second
+
+// frame is a JSON object exchanged with an out-of-process plugin
+type frame struct {
+	Type     string        `json:"type"`
+	ID       int64         `json:"id,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	User     string        `json:"user,omitempty"`
+	To       string        `json:"to,omitempty"`
+	Channel  string        `json:"channel,omitempty"`
+	Text     string        `json:"text,omitempty"`
+	Args     []string      `json:"args,omitempty"`
+	Veto     bool          `json:"veto,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Hooks    []string      `json:"hooks,omitempty"`
+	Commands []commandInfo `json:"commands,omitempty"`
+}
+
+type commandInfo struct {
+	Name  string `json:"name"`
+	Usage string `json:"usage"`
+}
+
+// Remote is a Plugin running in another process
+//
+type Remote struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	hello   frame
+
+	sync.Mutex // guards the fields below and writes to conn
+	id         int64
+	pending    map[int64]chan frame
+
+	done chan struct{}
+}
+
+// NewRemote reads the introduction of an out-of-process plugin connected
+// through conn
+func NewRemote(conn net.Conn) (*Remote, error) {
+	r := &Remote{
+		conn:    conn,
+		scanner: bufio.NewScanner(conn),
+		pending: make(map[int64]chan frame),
+		done:    make(chan struct{})}
+	r.scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+
+	conn.SetReadDeadline(time.Now().Add(10 * Timeout))
+	if !r.scanner.Scan() {
+		err := r.scanner.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if err := json.Unmarshal(r.scanner.Bytes(), &r.hello); err != nil {
+		return nil, err
+	}
+	if r.hello.Type != "hello" || r.hello.Name == "" {
+		return nil, errors.New("plugin didn't introduce itself")
+	}
+	return r, nil
+}
+
+// Name returns the name the plugin introduced itself with
+func (r *Remote) Name() string {
+	return r.hello.Name
+}
+
+func (r *Remote) write(f frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	_, err = r.conn.Write(append(data, '\n'))
+	return err
+}
+
+// call sends a request to the plugin and waits for its reply
+func (r *Remote) call(f frame) (frame, error) {
+	r.Lock()
+	r.id++
+	f.ID = r.id
+	reply := make(chan frame, 1)
+	r.pending[f.ID] = reply
+	r.Unlock()
+
+	defer func() {
+		r.Lock()
+		delete(r.pending, f.ID)
+		r.Unlock()
+	}()
+
+	if err := r.write(f); err != nil {
+		return frame{}, err
+	}
+
+	select {
+	case answer := <-reply:
+		return answer, nil
+	case <-time.After(Timeout):
+		return frame{}, errors.New("plugin " + r.Name() + " timed out")
+	}
+}
+
+// Init registers the hooks and commands the plugin asked for
+func (r *Remote) Init(host Host) error {
+	for _, hook := range r.hello.Hooks {
+		switch hook {
+		case "join":
+			host.OnJoin(func(user string) {
+				r.write(frame{Type: "join", User: user})
+			})
+		case "leave":
+			host.OnLeave(func(user string) {
+				r.write(frame{Type: "leave", User: user})
+			})
+		case "message":
+			host.OnMessage(func(m *Message) bool {
+				answer, err := r.call(frame{Type: "message", User: m.From, Channel: m.Channel, Text: m.Text})
+				if err != nil {
+					return true
+				}
+				if answer.Text != "" {
+					m.Text = answer.Text
+				}
+				return !answer.Veto
+			})
+		case "whisper":
+			host.OnWhisper(func(w *Whisper) bool {
+				answer, err := r.call(frame{Type: "whisper", User: w.From, To: w.To, Text: w.Text})
+				return err != nil || !answer.Veto
+			})
+		default:
+			return errors.New("unknown hook " + hook)
+		}
+	}
+
+	for _, c := range r.hello.Commands {
+		name := c.Name
+		err := host.Command(name, c.Usage, func(user string, args []string) (string, error) {
+			answer, err := r.call(frame{Type: "command", User: user, Name: name, Args: args})
+			if err == nil && answer.Error != "" {
+				err = errors.New(answer.Error)
+			}
+			return answer.Text, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	go r.read(host)
+	return nil
+}
+
+// read handles the frames of the plugin until it disconnects
+func (r *Remote) read(host Host) {
+	for r.scanner.Scan() {
+		var f frame
+		if err := json.Unmarshal(r.scanner.Bytes(), &f); err != nil {
+			continue
+		}
+
+		switch f.Type {
+		case "reply":
+			r.Lock()
+			reply, ok := r.pending[f.ID]
+			r.Unlock()
+			if ok {
+				select {
+				case reply <- f:
+				default:
+					// duplicate reply
+				}
+			}
+		case "say":
+			host.Say(f.Text)
+		case "tell":
+			host.Tell(f.To, f.Text)
+		}
+	}
+	r.conn.Close()
+	close(r.done)
+}
+
+// Done is closed once the plugin disconnected
+func (r *Remote) Done() <-chan struct{} {
+	return r.done
+}
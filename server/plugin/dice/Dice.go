@@ -0,0 +1,74 @@
+// Package dice is a plugin rolling dice for the users of the server with
+// /roll [N]d[M]
+package dice
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Spriithy/gochat-term/server/plugin"
+)
+
+func init() {
+	plugin.Register(dice{rand.New(rand.NewSource(time.Now().UnixNano()))})
+}
+
+type dice struct {
+	rand *rand.Rand
+}
+
+func (d dice) Name() string {
+	return "dice"
+}
+
+func (d dice) Init(host plugin.Host) error {
+	return host.Command("roll", "roll [N]d[M], ie. 2d6", func(user string, args []string) (string, error) {
+		n, sides := 1, 6
+		if len(args) > 0 {
+			var err error
+			if n, sides, err = parse(args[0]); err != nil {
+				return "", err
+			}
+		}
+
+		total := 0
+		rolls := make([]string, n)
+		for i := range rolls {
+			roll := d.rand.Intn(sides) + 1
+			total += roll
+			rolls[i] = strconv.Itoa(roll)
+		}
+
+		host.Say(user + " rolled " + strconv.Itoa(n) + "d" + strconv.Itoa(sides) + " : " + strings.Join(rolls, " + ") + " = " + strconv.Itoa(total))
+		return "", nil
+	})
+}
+
+// parse reads dice written as NdM, N defaulting to 1
+func parse(s string) (int, int, error) {
+	fields := strings.SplitN(strings.ToLower(s), "d", 2)
+	if len(fields) != 2 {
+		return 0, 0, errors.New("dice are written NdM, ie. 2d6")
+	}
+
+	n := 1
+	if fields[0] != "" {
+		var err error
+		if n, err = strconv.Atoi(fields[0]); err != nil {
+			return 0, 0, errors.New("invalid amount of dice " + fields[0])
+		}
+	}
+
+	sides, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, errors.New("invalid amount of sides " + fields[1])
+	}
+
+	if n < 1 || n > 100 || sides < 2 || sides > 1000 {
+		return 0, 0, errors.New("roll between 1 and 100 dice of 2 to 1000 sides")
+	}
+	return n, sides, nil
+}
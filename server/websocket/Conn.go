@@ -0,0 +1,278 @@
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455), just enough to carry gochat packets to browsers
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteTimeout is the editable time allowed to write a message to a peer
+// Default value = 10s
+var WriteTimeout = 10 * time.Second
+
+// frame opcodes
+const (
+	continuationFrame = 0x0
+	textFrame         = 0x1
+	binaryFrame       = 0x2
+	closeFrame        = 0x8
+	pingFrame         = 0x9
+	pongFrame         = 0xA
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrMessageTooLong is returned when a peer sends a message larger than the
+// limit of a Conn
+var ErrMessageTooLong = errors.New("websocket message too long")
+
+// Conn is a WebSocket connection accepted by Upgrade
+//
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// Limit is the maximum size of the messages read from the peer
+	Limit int
+
+	sync.Mutex // guards writes
+}
+
+// ErrForbiddenOrigin is returned when a page of another site opens a
+// WebSocket
+var ErrForbiddenOrigin = errors.New("websocket opened by a page of another origin")
+
+// Upgrade answers a WebSocket handshake, taking over the connection of the
+// request. Browsers may only open a WebSocket from a page of the same host,
+// or of one of origins (ie. https://chat.example.com), so that other sites
+// can't use the gateway on behalf of their visitors.
+func Upgrade(w http.ResponseWriter, r *http.Request, origins ...string) (*Conn, error) {
+	if !allowed(r, origins) {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return nil, ErrForbiddenOrigin
+	}
+
+	if r.Method != "GET" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, r: rw.Reader, Limit: 1 << 20}, nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept header answering key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// allowed tells whether the page opening a WebSocket may do so. Clients
+// other than browsers send no Origin.
+func allowed(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, o := range origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// readFrame reads a single frame sent by the peer, which must be masked
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		err = errors.New("unmasked frame from client")
+		return
+	}
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if size > uint64(c.Limit) {
+		err = ErrMessageTooLong
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// ReadMessage reads the next text or binary message of the peer, answering
+// pings on the way. io.EOF is returned once the peer closed the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case pingFrame:
+			c.writeFrame(pongFrame, payload)
+			continue
+		case pongFrame:
+			continue
+		case closeFrame:
+			c.writeFrame(closeFrame, payload)
+			return nil, io.EOF
+		case textFrame, binaryFrame:
+			if started {
+				return nil, errors.New("unexpected data frame in fragmented message")
+			}
+			started = true
+		case continuationFrame:
+			if !started {
+				return nil, errors.New("unexpected continuation frame")
+			}
+		default:
+			return nil, errors.New("unknown websocket opcode")
+		}
+
+		if len(message)+len(payload) > c.Limit {
+			return nil, ErrMessageTooLong
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err := c.conn.Write(append(head, payload...))
+	return err
+}
+
+// WriteMessage sends data to the peer as a single binary message
+func (c *Conn) WriteMessage(data []byte) error {
+	return c.writeFrame(binaryFrame, data)
+}
+
+// Write sends p as a single binary message, so that a Conn may be used as an
+// io.Writer
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.WriteMessage(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame to the peer and closes the connection
+func (c *Conn) Close() error {
+	c.writeFrame(closeFrame, nil)
+	return c.conn.Close()
+}
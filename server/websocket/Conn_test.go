@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// example of RFC 6455, section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %s", got)
+	}
+}
+
+// maskedFrame builds a frame as sent by a client
+func maskedFrame(fin bool, opcode byte, payload string) []byte {
+	mask := []byte{1, 2, 3, 4}
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+
+	frame := append([]byte{head, 0x80 | byte(len(payload))}, mask...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+func TestOrigin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := Upgrade(w, r, "https://chat.example.com"); err == nil {
+			c.Close()
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://test", http.StatusSwitchingProtocols},
+		{"https://chat.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		origin := ""
+		if test.origin != "" {
+			origin = "Origin: " + test.origin + "\r\n"
+		}
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" + origin +
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("origin %q : unexpected status %s", test.origin, resp.Status)
+		}
+		conn.Close()
+	}
+}
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		for {
+			m, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(m)
+		}
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	// a fragmented message with a ping in between
+	conn.Write(maskedFrame(false, textFrame, "hel"))
+	conn.Write(maskedFrame(true, pingFrame, "?"))
+	conn.Write(maskedFrame(true, continuationFrame, "lo"))
+
+	expect := func(opcode byte, payload string) {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(r, head); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, head[1])
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		if head[0] != 0x80|opcode || string(data) != payload {
+			t.Errorf("got frame %x %q, expected %x %q", head[0], data, 0x80|opcode, payload)
+		}
+	}
+
+	expect(pongFrame, "?")
+	expect(binaryFrame, "hello")
+}